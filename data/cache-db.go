@@ -3,6 +3,7 @@ package data
 import (
 	"bufio"
 	"errors"
+	"math"
 	"os"
 	"path/filepath"
 	"strconv"
@@ -51,6 +52,15 @@ type CacheEntry struct {
 	// if zero, start from the beginning (obviously!), but also is excluded
 	// from the cache.db file
 	resume uint64
+	// number of milliseconds of silence which have been skipped while
+	// playing this media file, stored in the file as fractional seconds
+	saved uint64
+	// length of the media file in seconds, if known, used to calculate
+	// listening progress
+	length uint64
+	// unix epoch time at which the media file was last being listened to,
+	// or zero if not known
+	listened int64
 }
 
 // The CacheDB contains the timestamps which specify when media was last played
@@ -62,7 +72,9 @@ type CacheEntry struct {
 // file. The timestamp is simply a 64-bit unix timestamp, however negative
 // values are interpreted as pruned items (i.e items cleaned via cache cleanup)
 // and will be excluded from deserialization. I doubt that anybody will have
-// listen times in the 1960s.
+// listen times in the 1960s. The timestamp may optionally be followed by the
+// resume timecode, the number of seconds of skipped silence, the length of the
+// media in seconds and then the time at which it was last listened to.
 //
 // The cache.db is assumed to be under the exclusive control of podbit and as
 // such is not reloaded during operation and may only be
@@ -119,7 +131,7 @@ func (c *CacheDB) Open() error {
 		fields := strings.Fields(elem)
 
 		if len(fields) < 2 {
-			return CacheSyntaxError{i, "insufficient fields (expect 2/3)"}
+			return CacheSyntaxError{i, "insufficient fields (expect 2-6)"}
 		}
 
 		stamp, err := strconv.ParseInt(fields[1], 10, 64)
@@ -128,7 +140,7 @@ func (c *CacheDB) Open() error {
 		}
 
 		resume := uint64(0)
-		if len(fields) == 3 {
+		if len(fields) >= 3 {
 			r, err := strconv.ParseUint(fields[2], 10, 64)
 			if err != nil {
 				return CacheSyntaxError{i, "parsing resume timecode: " + err.Error()}
@@ -137,6 +149,36 @@ func (c *CacheDB) Open() error {
 			resume = r
 		}
 
+		saved := uint64(0)
+		if len(fields) >= 4 {
+			sv, err := strconv.ParseFloat(fields[3], 64)
+			if err != nil || sv < 0 {
+				return CacheSyntaxError{i, "parsing skipped silence: invalid number of seconds"}
+			}
+
+			saved = uint64(math.Round(sv * 1000))
+		}
+
+		length := uint64(0)
+		if len(fields) >= 5 {
+			l, err := strconv.ParseUint(fields[4], 10, 64)
+			if err != nil {
+				return CacheSyntaxError{i, "parsing length: " + err.Error()}
+			}
+
+			length = l
+		}
+
+		listened := int64(0)
+		if len(fields) >= 6 {
+			l, err := strconv.ParseInt(fields[5], 10, 64)
+			if err != nil {
+				return CacheSyntaxError{i, "parsing listen time: " + err.Error()}
+			}
+
+			listened = l
+		}
+
 		// If we have duplicates somehow take the later stamp.
 		s, ok := c.db[fields[0]]
 		if ok {
@@ -144,7 +186,7 @@ func (c *CacheDB) Open() error {
 				continue
 			}
 		}
-		c.db[fields[0]] = CacheEntry{stamp, resume}
+		c.db[fields[0]] = CacheEntry{stamp, resume, saved, length, listened}
 
 		i++
 	}
@@ -175,54 +217,187 @@ func (c *CacheDB) Save() error {
 			continue
 		}
 
-		sts := strconv.FormatInt(ts.finished, 10)
-		res := strconv.FormatUint(ts.resume, 10)
+		fields := []string{
+			url,
+			strconv.FormatInt(ts.finished, 10),
+			strconv.FormatUint(ts.resume, 10),
+			strconv.FormatFloat(float64(ts.saved)/1000, 'f', -1, 64),
+			strconv.FormatUint(ts.length, 10),
+			strconv.FormatInt(ts.listened, 10),
+		}
 
-		if ts.resume != 0 {
-			f.WriteString(url + " " + sts + " " + res + "\n")
-			continue
+		// Trailing zero fields are omitted
+		n := len(fields)
+		for n > 2 && fields[n-1] == "0" {
+			n--
 		}
-		f.WriteString(url + " " + sts + "\n")
+		f.WriteString(strings.Join(fields[:n], " ") + "\n")
 	}
 
 	return nil
 }
 
 // Touch updates the listen time for an episode to the current timestamp. This
-// method refuses to update the timestamp for any file which does not exist, so
-// this should be checked first.
+// method refuses to update the timestamp for any file which does not exist
+// and is not being downloaded, so this should be checked first.
 func (c *CacheDB) Touch(path string) error {
-	// Refuse to touch a non existent path
+	// Refuse to touch a non existent path, unless still downloading
 	_, err := os.Stat(path)
 	if err != nil {
-		return err
+		if _, perr := os.Stat(path + PartSuffix); perr != nil {
+			return err
+		}
 	}
 
 	c.mut.Lock()
 	defer c.mut.Unlock()
 
-	c.db[path] = CacheEntry{time.Now().Unix(), 0}
+	orig := c.db[path]
+	now := time.Now().Unix()
+	c.db[path] = CacheEntry{now, 0, orig.saved, orig.length, now}
 	return nil
 }
 
 // Resume is like Touch, except it sets the resume timecode to the given value.
 // Normal touches implicitly reset the resume timecode back to zero, so ensure
-// that this is called after any touch calls, if they should be made.
+// that this is called after any touch calls, if they should be made. As the
+// episode was being listened to until now, the last listen time is updated,
+// but the timestamp used for cache cleanups is not, unless there was none.
 func (c *CacheDB) Resume(path string, rt uint64) error {
-	// Refuse to touch a non existent path
+	// Refuse to touch a non existent path, unless still downloading
 	_, err := os.Stat(path)
 	if err != nil {
-		return err
+		if _, perr := os.Stat(path + PartSuffix); perr != nil {
+			return err
+		}
 	}
 
 	c.mut.Lock()
 	defer c.mut.Unlock()
 
-	orig := c.db[path]
-	c.db[path] = CacheEntry{orig.finished, rt}
+	now := time.Now().Unix()
+	orig, ok := c.db[path]
+	if !ok {
+		orig.finished = now
+	}
+	c.db[path] = CacheEntry{orig.finished, rt, orig.saved, orig.length, now}
+	return nil
+}
+
+// SetResume sets the resume timecode of an entry to the given value, without
+// changing the listen time.
+func (c *CacheDB) SetResume(path string, rt uint64) error {
+	c.mut.Lock()
+	defer c.mut.Unlock()
+
+	orig, ok := c.db[path]
+	if !ok {
+		return ErrDBEnoent
+	}
+	if orig.finished < 0 {
+		return ErrDBPruned
+	}
+
+	c.db[path] = CacheEntry{orig.finished, rt, orig.saved, orig.length, orig.listened}
+	return nil
+}
+
+// AddSaved adds d to the total silence which has been skipped while playing
+// an episode. The total is kept to the millisecond.
+func (c *CacheDB) AddSaved(path string, d time.Duration) error {
+	c.mut.Lock()
+	defer c.mut.Unlock()
+
+	orig, ok := c.db[path]
+	if !ok {
+		return ErrDBEnoent
+	}
+	if orig.finished < 0 {
+		return ErrDBPruned
+	}
+
+	orig.saved += uint64(d.Milliseconds())
+	c.db[path] = orig
 	return nil
 }
 
+// Saved returns the total silence which has been skipped while playing an
+// episode. This can fail if an entry does not exist, or if the entry was
+// marked for pruning.
+func (c *CacheDB) Saved(path string) (time.Duration, error) {
+	c.mut.RLock()
+	defer c.mut.RUnlock()
+
+	s, ok := c.db[path]
+	if !ok {
+		return 0, ErrDBEnoent
+	}
+	if s.finished < 0 {
+		return 0, ErrDBPruned
+	}
+
+	return time.Duration(s.saved) * time.Millisecond, nil
+}
+
+// SetLength records the length of the media of an entry in seconds, used to
+// calculate listening progress.
+func (c *CacheDB) SetLength(path string, secs uint64) error {
+	c.mut.Lock()
+	defer c.mut.Unlock()
+
+	orig, ok := c.db[path]
+	if !ok {
+		return ErrDBEnoent
+	}
+	if orig.finished < 0 {
+		return ErrDBPruned
+	}
+
+	orig.length = secs
+	c.db[path] = orig
+	return nil
+}
+
+// Length returns the recorded length of the media of an entry in seconds, or
+// zero if not known. This can fail if an entry does not exist, or if the entry
+// was marked for pruning.
+func (c *CacheDB) Length(path string) (uint64, error) {
+	c.mut.RLock()
+	defer c.mut.RUnlock()
+
+	s, ok := c.db[path]
+	if !ok {
+		return 0, ErrDBEnoent
+	}
+	if s.finished < 0 {
+		return 0, ErrDBPruned
+	}
+
+	return s.length, nil
+}
+
+// Listened returns the time at which an entry was last being listened to. If
+// this is not known, the timestamp of the entry is returned instead. This can
+// fail if an entry does not exist, or if the entry was marked for pruning.
+func (c *CacheDB) Listened(path string) (time.Time, error) {
+	c.mut.RLock()
+	defer c.mut.RUnlock()
+
+	s, ok := c.db[path]
+	if !ok {
+		return time.Time{}, ErrDBEnoent
+	}
+	if s.finished < 0 {
+		return time.Time{}, ErrDBPruned
+	}
+
+	if s.listened == 0 {
+		return time.Unix(s.finished, 0), nil
+	}
+
+	return time.Unix(s.listened, 0), nil
+}
+
 // Insert inserts a new path with the given timestamp into the map. Panics if
 // ts < 0.
 func (c *CacheDB) Insert(path string, ts int64) error {
@@ -238,7 +413,7 @@ func (c *CacheDB) Insert(path string, ts int64) error {
 		return ErrDBExists
 	}
 
-	c.db[path] = CacheEntry{ts, 0}
+	c.db[path] = CacheEntry{ts, 0, 0, 0, 0}
 	return nil
 }
 
@@ -259,7 +434,7 @@ func (c *CacheDB) Prune(path string) error {
 	}
 
 	// Mark as pruned with negative timestamp
-	c.db[path] = CacheEntry{-1, 0}
+	c.db[path] = CacheEntry{-1, 0, 0, 0, 0}
 	return nil
 }
 
@@ -21,6 +21,21 @@ var (
 	ErrorDownloadFailed = "Error: Failed to download from url %s"
 )
 
+// Download priorities, from lowest to highest.
+const (
+	PriorityNormal = iota // Requested by the user
+	PriorityQueue         // Upcoming in the play queue
+	PriorityPlayer        // Needed by the player right now
+)
+
+// MaxFinished is the number of finished downloads which are kept in the
+// downloads table. Older finished downloads remain in the download log.
+var MaxFinished = 50
+
+// MaxDownloads is the maximum number of downloads which may run at once.
+// Further downloads are queued until a download finishes.
+var MaxDownloads = 4
+
 // Cache is the current state of the on-disk cache and associated
 // operations.
 //
@@ -29,9 +44,16 @@ var (
 type Cache struct {
 	episodes sync.Map
 
-	downloadsMutex sync.RWMutex // Protects the below two variables
+	downloadsMutex sync.RWMutex // Protects the below variables
 	downloads      []*Download
 	ongoing        int
+	backlog        []*Download
+	active         int
+	windowWake     bool
+	nextID         int
+
+	historyMutex sync.Mutex // Protects the download log
+	history      []LogEntry
 
 	hndl ev.Handler
 }
@@ -44,6 +66,11 @@ type Episode struct {
 	Title string
 	Date  int
 	Host  string
+
+	// Duration is the estimated length of the episode, or zero if unknown
+	Duration time.Duration
+	// Thumbnail is the URL of an image for the episode, if known
+	Thumbnail string
 }
 
 // Dig through newsboat stuff to guess the download dir.
@@ -72,6 +99,7 @@ func (c *Cache) Open(q *Queue, hndl ev.Handler) error {
 		panic("open cache: nil queue passed")
 	}
 	c.hndl = hndl
+	c.loadHistory()
 
 	for _, elem := range q.Items {
 		c.loadFile(elem.Path, true)
@@ -94,8 +122,17 @@ func (c *Cache) loadFile(path string, startup bool) {
 		}
 	}()
 
+	meta, hasMeta := readMeta(path)
+
 	data, err := tag.ReadFrom(file)
 	if err != nil {
+		if hasMeta {
+			ep := Episode{Queued: !startup, Duration: probeDuration(file)}
+			meta.apply(&ep)
+			c.episodes.Store(path, ep)
+			return
+		}
+
 		fmt.Printf("\nError: Invalid media file %q in cache! Ignoring...\n", path)
 		return
 	}
@@ -109,25 +146,38 @@ func (c *Cache) loadFile(path string, startup bool) {
 	}
 
 	ep := Episode{
-		Queued: !startup,
-		Title:  data.Title(),
-		Date:   data.Year(),
-		Host:   host,
+		Queued:   !startup,
+		Title:    data.Title(),
+		Date:     data.Year(),
+		Host:     host,
+		Duration: probeDuration(file),
+	}
+	if hasMeta {
+		meta.apply(&ep)
 	}
 
 	c.episodes.Store(path, ep)
 }
 
-// Download starts an asynchronous download in a new goroutine. Returns the ID
-// in the downloads table, which must be accessed using a mutex. Item passed
-// should be locked by the caller prior to calling.
+// Download queues a download at normal priority. Returns the ID in the
+// downloads table, which must be accessed using a mutex. Item passed should be
+// locked by the caller prior to calling.
 func (c *Cache) Download(item *QueueItem) (id int, err error) {
+	return c.DownloadPriority(item, PriorityNormal)
+}
+
+// DownloadPriority queues a download, to be started by the scheduler once
+// there is a free worker and no download of higher priority is waiting.
+// Downloads of equal priority are started in the order they were queued.
+// Item passed should be locked by the caller prior to calling.
+func (c *Cache) DownloadPriority(item *QueueItem, prio int) (id int, err error) {
 	dir := filepath.Dir(item.Path)
 	err = os.MkdirAll(dir, os.ModePerm)
 	if err != nil {
 		dl := Download{
 			mut:       new(sync.RWMutex),
 			Path:      item.Path,
+			URL:       item.URL,
 			File:      nil,
 			Elem:      item,
 			Started:   time.Now(),
@@ -138,57 +188,318 @@ func (c *Cache) Download(item *QueueItem) (id int, err error) {
 		}
 
 		c.downloadsMutex.Lock()
-		c.downloads = append(c.downloads, &dl)
-		id = len(c.downloads) - 1
+		id = c.add(&dl)
 		c.downloadsMutex.Unlock()
 
+		c.logDownload(&dl)
 		return id, ErrorIO
 	}
 
-	f, err := os.Create(item.Path)
 	dl := Download{
-		mut:     new(sync.RWMutex),
-		Path:    item.Path,
-		File:    f,
-		Elem:    item,
-		Started: time.Now(),
-		Stop:    make(chan int),
+		mut:      new(sync.RWMutex),
+		Path:     item.Path,
+		URL:      item.URL,
+		Elem:     item,
+		Started:  time.Now(),
+		Queued:   true,
+		Priority: prio,
+		Stop:     make(chan int),
+		stopOnce: new(sync.Once),
+		Limit:    DownloadLimit,
+		limit:    new(bucket),
 	}
 
-	if err != nil {
-		dl = Download{
-			mut:       new(sync.RWMutex),
-			Path:      item.Path,
-			File:      f,
-			Elem:      item,
-			Started:   time.Now(),
-			Completed: true,
-			Success:   false,
-			Error:     "IO Error",
-			Stop:      nil,
+	c.downloadsMutex.Lock()
+	id = c.add(&dl)
+	c.ongoing++
+	c.backlog = append(c.backlog, &dl)
+	c.schedule()
+	c.downloadsMutex.Unlock()
+
+	return
+}
+
+// add adds a download to the downloads table, returning its ID. Once the
+// table is full, the oldest finished downloads are removed. The downloads
+// mutex must be held.
+func (c *Cache) add(dl *Download) int {
+	c.nextID++
+	dl.ID = c.nextID
+	c.downloads = append(c.downloads, dl)
+
+	finished := 0
+	for _, elem := range c.downloads {
+		if elem != dl && elem.isCompleted() {
+			finished++
+		}
+	}
+
+	kept := c.downloads[:0]
+	for _, elem := range c.downloads {
+		if finished > MaxFinished && elem != dl && elem.isCompleted() {
+			finished--
+			continue
+		}
+		kept = append(kept, elem)
+	}
+	c.downloads = kept
+
+	return dl.ID
+}
+
+// find returns the download with the given ID, or nil if there is none. The
+// downloads mutex must be held.
+func (c *Cache) find(id int) *Download {
+	for _, elem := range c.downloads {
+		if elem.ID == id {
+			return elem
 		}
+	}
+
+	return nil
+}
+
+// clear removes finished downloads which succeeded or failed from the
+// downloads table.
+func (c *Cache) clear(success bool) {
+	c.downloadsMutex.Lock()
+	defer c.downloadsMutex.Unlock()
 
+	kept := c.downloads[:0]
+	for _, elem := range c.downloads {
+		elem.mut.RLock()
+		remove := elem.Completed && elem.Success == success
+		elem.mut.RUnlock()
+
+		if !remove {
+			kept = append(kept, elem)
+		}
+	}
+	c.downloads = kept
+}
+
+// ClearCompleted removes successful downloads from the downloads table.
+func (c *Cache) ClearCompleted() {
+	c.clear(true)
+}
+
+// ClearFailed removes failed and cancelled downloads from the downloads
+// table.
+func (c *Cache) ClearFailed() {
+	c.clear(false)
+}
+
+// schedule starts queued downloads until all workers are busy, taking the
+// highest priority download first. Downloads waiting to be retried are
+// skipped until their retry time, and downloads only start outside of the
+// download windows if needed by the player. The downloads mutex must be held.
+func (c *Cache) schedule() {
+	now := time.Now()
+	open := WindowOpen(now)
+	if !open && len(c.backlog) > 0 && !c.windowWake {
+		c.windowWake = true
+		time.AfterFunc(time.Until(NextWindow(now)), func() {
+			c.downloadsMutex.Lock()
+			c.windowWake = false
+			c.schedule()
+			c.downloadsMutex.Unlock()
+		})
+	}
+
+	for c.active < MaxDownloads {
+		next := -1
+		for i, dl := range c.backlog {
+			if dl.held(now, open) {
+				continue
+			}
+			if next < 0 || dl.Priority > c.backlog[next].Priority {
+				next = i
+			}
+		}
+		if next < 0 {
+			break
+		}
+
+		dl := c.backlog[next]
+		c.backlog = append(c.backlog[:next], c.backlog[next+1:]...)
+		c.active++
+
+		go c.run(dl)
+	}
+}
+
+// held returns true if a queued download may not start yet, either as it is
+// waiting to be retried or as it is outside of the download windows. open is
+// true if a download window is open.
+func (dl *Download) held(now time.Time, open bool) bool {
+	return dl.NextRetry.After(now) || (!open && dl.Priority < PriorityPlayer)
+}
+
+// run performs a download which has been taken from the backlog, then
+// frees its worker for the next download.
+func (c *Cache) run(dl *Download) {
+	// Downloads are written to a partial file until complete, which is
+	// resumed from if it already exists
+	f, err := os.OpenFile(dl.Path+PartSuffix, os.O_CREATE|os.O_WRONLY, 0666)
+
+	dl.mut.Lock()
+	dl.Queued = false
+	dl.Started = time.Now()
+	dl.File = f
+	dl.Attempts++
+	dl.NextRetry = time.Time{}
+	if err != nil {
+		dl.Completed = true
+		dl.Success = false
+		dl.Error = "IO Error"
+	}
+	dl.mut.Unlock()
+
+	if err != nil {
 		c.downloadsMutex.Lock()
-		c.downloads = append(c.downloads, &dl)
-		id = len(c.downloads) - 1
+		c.ongoing--
 		c.downloadsMutex.Unlock()
 
-		return id, ErrorIO
-	}
+		c.logDownload(dl)
 
-	if item.Youtube {
-		go dl.DownloadYoutube(c.hndl)
+		c.hndl.Post(ev.DownloadChanged)
+	} else if dl.Elem.Youtube {
+		dl.DownloadYoutube(c.hndl)
 	} else {
-		go dl.DownloadHTTP(c.hndl)
+		dl.DownloadHTTP(c.hndl)
 	}
 
 	c.downloadsMutex.Lock()
-	c.downloads = append(c.downloads, &dl)
-	id = len(c.downloads) - 1
-	c.ongoing++
+	c.active--
+
+	// Failed attempt to be retried later, unless cancelled since
+	dl.mut.Lock()
+	retry := !dl.Completed && !dl.NextRetry.IsZero()
+	if retry && dl.cancelled {
+		retry = false
+		dl.Completed = true
+		dl.Success = false
+		dl.Error = "Cancelled"
+		dl.NextRetry = time.Time{}
+		c.ongoing--
+	}
+	if retry {
+		dl.Queued = true
+		c.backlog = append(c.backlog, dl)
+		time.AfterFunc(time.Until(dl.NextRetry), c.wake)
+	}
+	dl.mut.Unlock()
+
+	c.schedule()
 	c.downloadsMutex.Unlock()
 
-	return
+	if !retry && err == nil {
+		c.logDownload(dl)
+	}
+}
+
+// wake starts any downloads which have become ready to retry.
+func (c *Cache) wake() {
+	c.downloadsMutex.Lock()
+	c.schedule()
+	c.downloadsMutex.Unlock()
+}
+
+// RetryNow retries the download with the given ID immediately, if it is
+// waiting to be retried. Returns false if it is not waiting.
+func (c *Cache) RetryNow(id int) bool {
+	c.downloadsMutex.Lock()
+	defer c.downloadsMutex.Unlock()
+
+	dl := c.find(id)
+	if dl == nil {
+		return false
+	}
+
+	dl.mut.Lock()
+	waiting := dl.Queued && !dl.NextRetry.IsZero()
+	if waiting {
+		dl.NextRetry = time.Time{}
+	}
+	dl.mut.Unlock()
+
+	if waiting {
+		c.schedule()
+	}
+
+	return waiting
+}
+
+// SetLimit sets the bandwidth limit of the download with the given ID in
+// bytes per second, or zero for unlimited. YouTube downloads which have
+// already started keep the limit they were started with.
+func (c *Cache) SetLimit(id int, limit int64) {
+	c.downloadsMutex.RLock()
+	defer c.downloadsMutex.RUnlock()
+
+	if dl := c.find(id); dl != nil {
+		dl.mut.Lock()
+		dl.Limit = limit
+		dl.mut.Unlock()
+	}
+}
+
+// Prioritise raises the priority of a queued download of path to at least
+// prio, so that it is started sooner.
+func (c *Cache) Prioritise(path string, prio int) {
+	c.downloadsMutex.Lock()
+	defer c.downloadsMutex.Unlock()
+
+	for _, dl := range c.backlog {
+		if dl.Path == path && dl.Priority < prio {
+			dl.Priority = prio
+		}
+	}
+}
+
+// Cancel stops the download with the given ID. A queued download is removed
+// from the backlog without being started, and a running download is not
+// retried should its current attempt fail.
+func (c *Cache) Cancel(id int) {
+	c.downloadsMutex.Lock()
+	defer c.downloadsMutex.Unlock()
+
+	dl := c.find(id)
+	if dl == nil {
+		return
+	}
+
+	dl.mut.Lock()
+	defer dl.mut.Unlock()
+
+	if dl.Completed {
+		return
+	}
+
+	// The download may have been taken by a worker, but not yet started
+	queued := false
+	for i, elem := range c.backlog {
+		if elem == dl {
+			c.backlog = append(c.backlog[:i], c.backlog[i+1:]...)
+			queued = true
+			break
+		}
+	}
+
+	if queued {
+		dl.Queued = false
+		dl.Completed = true
+		dl.Success = false
+		dl.Error = "Cancelled"
+		c.ongoing--
+
+		go c.logDownload(dl)
+		go c.hndl.Post(ev.DownloadChanged)
+		return
+	}
+
+	dl.cancelled = true
+	dl.stop()
 }
 
 // IsDownloading queries the download cache to check.
@@ -197,11 +508,11 @@ func (c *Cache) IsDownloading(path string) (bool, int) {
 	c.downloadsMutex.RLock()
 	defer c.downloadsMutex.RUnlock()
 
-	for i, elem := range c.downloads {
+	for _, elem := range c.downloads {
 		elem.mut.RLock()
 		if elem.Path == path && !elem.Completed {
 			elem.mut.RUnlock()
-			return true, i
+			return true, elem.ID
 		}
 		elem.mut.RUnlock()
 	}
@@ -211,21 +522,42 @@ func (c *Cache) IsDownloading(path string) (bool, int) {
 
 // GetDownload returns the specified download in a thread-safely.
 // This should be used to get the details of a specified download
-// via the ID.
-func (c *Cache) GetDownload(ind int) Download {
-	c.downloads[ind].mut.RLock()
-	defer c.downloads[ind].mut.RUnlock()
+// via the ID. Returns false if there is no download with the ID, as
+// finished downloads are removed from the table over time.
+func (c *Cache) GetDownload(id int) (Download, bool) {
+	c.downloadsMutex.RLock()
+	defer c.downloadsMutex.RUnlock()
+
+	dl := c.find(id)
+	if dl == nil {
+		return Download{}, false
+	}
+
+	dl.mut.RLock()
+	defer dl.mut.RUnlock()
 
-	return *c.downloads[ind]
+	return *dl, true
 }
 
-// Ongoing returns the current number of ongoing downloads.
+// Ongoing returns the current number of ongoing downloads. Downloads which
+// are waiting to be retried or for a download window are not counted, as
+// they may not start for some time and are resumed when next downloaded.
 // The value cannot change while this function is executing.
 func (c *Cache) Ongoing() int {
 	c.downloadsMutex.RLock()
 	defer c.downloadsMutex.RUnlock()
 
-	return c.ongoing
+	now := time.Now()
+	open := WindowOpen(now)
+
+	n := c.ongoing
+	for _, dl := range c.backlog {
+		if dl.held(now, open) {
+			n--
+		}
+	}
+
+	return n
 }
 
 // Downloads returns all recorded downloads at this point,
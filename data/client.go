@@ -0,0 +1,167 @@
+package data
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"time"
+)
+
+// ErrorCABundle is returned when the extra CA bundle contains no
+// certificates.
+var ErrorCABundle = errors.New("Error: No certificates found in CA bundle")
+
+// HTTP client configuration, applied by InitClient.
+var (
+	// ConnectTimeout is the time allowed to connect to a server, including
+	// the TLS handshake. Zero is no timeout.
+	ConnectTimeout = 30 * time.Second
+	// IdleTimeout is the time allowed without receiving any data before a
+	// download is abandoned. Zero is no timeout.
+	IdleTimeout = 60 * time.Second
+	// Proxy is the URL of the proxy through which to make requests. If
+	// empty, the proxy is taken from the environment.
+	Proxy string
+	// UserAgent is sent with every request.
+	UserAgent = "podbit"
+	// CABundle is the path of a PEM file of extra certificate authorities to
+	// trust, in addition to those of the system.
+	CABundle string
+)
+
+// client makes all HTTP requests for downloads.
+var client = http.DefaultClient
+
+// idleConn is a connection which fails reads which receive nothing for
+// longer than the idle timeout.
+type idleConn struct {
+	net.Conn
+	idle time.Duration
+}
+
+func (c idleConn) Read(b []byte) (int, error) {
+	c.SetReadDeadline(time.Now().Add(c.idle))
+	return c.Conn.Read(b)
+}
+
+// InitClient builds the HTTP client used for downloads from the client
+// configuration.
+func InitClient() error {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSHandshakeTimeout = ConnectTimeout
+
+	dialer := &net.Dialer{
+		Timeout:   ConnectTimeout,
+		KeepAlive: 30 * time.Second,
+	}
+	transport.DialContext = func(ctx context.Context, network, addr string) (net.Conn, error) {
+		conn, err := dialer.DialContext(ctx, network, addr)
+		if err != nil || IdleTimeout <= 0 {
+			return conn, err
+		}
+
+		return idleConn{conn, IdleTimeout}, nil
+	}
+
+	if Proxy != "" {
+		u, err := url.Parse(Proxy)
+		if err != nil {
+			return fmt.Errorf("Error: Invalid proxy URL: %w", err)
+		}
+		transport.Proxy = http.ProxyURL(u)
+	}
+
+	if CABundle != "" {
+		pem, err := os.ReadFile(CABundle)
+		if err != nil {
+			return fmt.Errorf("Error: Failed to read CA bundle: %w", err)
+		}
+
+		pool, err := x509.SystemCertPool()
+		if err != nil {
+			pool = x509.NewCertPool()
+		}
+		if !pool.AppendCertsFromPEM(pem) {
+			return ErrorCABundle
+		}
+
+		transport.TLSClientConfig = &tls.Config{RootCAs: pool}
+	}
+
+	client = &http.Client{Transport: transport, CheckRedirect: checkRedirect}
+	return nil
+}
+
+// maxRedirects is the number of redirects followed before a request fails.
+const maxRedirects = 10
+
+// checkRedirect drops the headers and credentials configured for a podcast
+// when a request is redirected to another host, so that they are only sent
+// to the host of the podcast.
+func checkRedirect(req *http.Request, via []*http.Request) error {
+	if len(via) >= maxRedirects {
+		return fmt.Errorf("stopped after %d redirects", maxRedirects)
+	}
+
+	first := via[0]
+	if req.URL.Host == first.URL.Host {
+		return nil
+	}
+
+	for key := range DB.GetOwner(first.URL.String()).Options.Headers {
+		req.Header.Del(key)
+	}
+	req.Header.Del("Authorization")
+	req.Header.Set("User-Agent", UserAgent)
+
+	return nil
+}
+
+// newRequest creates a GET request for url, with the configured User-Agent
+// and any headers or credentials configured for the owning podcast.
+func newRequest(url string) (*http.Request, error) {
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	req.Header.Set("User-Agent", UserAgent)
+
+	opts := DB.GetOwner(url).Options
+	for key, val := range opts.Headers {
+		req.Header.Set(key, val)
+	}
+	if opts.Username != "" || opts.Password != "" {
+		req.SetBasicAuth(opts.Username, opts.Password)
+	}
+
+	return req, nil
+}
+
+// ContentLength asks the server for the size of the resource at url without
+// downloading it. Returns zero if the size is not known.
+func ContentLength(url string) int64 {
+	req, err := newRequest(url)
+	if err != nil {
+		return 0
+	}
+	req.Method = http.MethodHead
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return 0
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK || resp.ContentLength < 0 {
+		return 0
+	}
+
+	return resp.ContentLength
+}
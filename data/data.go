@@ -10,6 +10,7 @@ import (
 	"fmt"
 	"net/url"
 	"os"
+	"path/filepath"
 	"time"
 
 	ev "github.com/ejv2/podbit/event"
@@ -72,6 +73,19 @@ func InitData(hndl ev.Handler) error {
 	return nil
 }
 
+// InitQueue initialises only the queue and the data needed to parse it, for
+// commands which may run alongside another instance of podbit.
+func InitQueue() error {
+	Stamps = NewCacheDB()
+
+	err := DB.Open()
+	if err != nil {
+		return err
+	}
+
+	return Q.Open()
+}
+
 // SaveData cleans up and saves data to disk. First ensures we have
 // hot-reloaded any required data. Only designed for use at startup.
 func SaveData() {
@@ -89,18 +103,23 @@ func SaveData() {
 // and upon saving to ensure up-to-date data.
 func ReloadData() {
 	Q.Reload()
+	RefreshPlaylists()
 }
 
 // CleanData cleans out the cache based on items which are both finished/played
 // and with a last listen time of more than EpisodeCacheTime seconds ago
 // (defaults to three days). Removed episodes are set to "pending" status (to
-// be downloaded) and have their cache file removed.
+// be downloaded) and have their cache file moved to the trash, replacing the
+// episodes removed by the previous cleanup.
 func CleanData() {
 	fmt.Printf("Cache cleanup...")
 
 	now := time.Now().Unix()
 	count := 0
 
+	emptyTrash()
+	var trashed []Trashed
+
 	Q.Range(func(_ int, item *QueueItem) bool {
 		if item.State != StatePlayed && item.State != StateFinished {
 			return true
@@ -115,19 +134,33 @@ func CleanData() {
 
 		// If past expiry date OR never present in cache.db in the first place, prune it
 		if diff >= EpisodeCacheTime || err != nil {
+			// An episode which cannot be trashed is kept, as removing it
+			// could not be undone
+			t, terr := trashEpisode(item, count)
+			switch {
+			case terr == nil:
+				trashed = append(trashed, t)
+			case !os.IsNotExist(terr):
+				fmt.Printf("\nError: Failed to move %q to trash: %s\n", item.Path, terr)
+				return true
+			}
+
 			item.State = StatePending
 			if err == nil {
 				// Ignoring error here as we check the necessary condition above
 				Stamps.Prune(item.Path)
 			}
 
-			os.Remove(item.Path)
 			count++
 		}
 
 		return true
 	})
 
+	if len(trashed) > 0 {
+		writeTrash(trashed)
+	}
+
 	fmt.Printf("done (removed %d items)\n", count)
 }
 
@@ -138,8 +171,12 @@ func CleanData() {
 // things.
 func ReloadLoop(upchan chan int8) {
 	ticker := time.NewTicker(QueueReloadInterval)
+	watch := time.NewTicker(WatchInterval)
 	count := 0
 	defer ticker.Stop()
+	defer watch.Stop()
+
+	go RefreshWatched()
 
 loop:
 	for {
@@ -153,12 +190,15 @@ loop:
 				continue
 			}
 			count++
+		case <-watch.C:
+			go RefreshWatched()
 		case i, ok := <-upchan:
 			if !ok {
 				break loop
 			}
 
 			ReloadData()
+			go RefreshWatched()
 			if i == DataSave {
 				Q.Save()
 				Stamps.Save()
@@ -167,6 +207,18 @@ loop:
 	}
 }
 
+// DataPath returns the path to the file called name inside of podbit's data
+// directory, which is the same directory in which the database is stored.
+func DataPath(name string) string {
+	data := os.Getenv("XDG_DATA_HOME")
+	if data == "" {
+		home, _ := os.UserHomeDir()
+		data = filepath.Join(home, ".local/share")
+	}
+
+	return filepath.Join(data, DatabaseDirname, name)
+}
+
 // IsURL returns true if a string is a valid HTTP(s) URL.
 func IsURL(check string) bool {
 	u, err := url.Parse(check)
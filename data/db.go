@@ -29,6 +29,9 @@ type Podcast struct {
 	RegexPattern string
 	FriendlyName string
 
+	// Options are the settings for this podcast from the options file.
+	Options PodcastOptions
+
 	pat *regexp.Regexp
 }
 
@@ -131,6 +134,15 @@ func (db *Database) Open() error {
 	}
 	db.podcasts = append(db.podcasts, db.defaultPodcast)
 
+	opts, err := readOptions(DataPath(OptionsFilename))
+	if err != nil {
+		return err
+	}
+	for i := range db.podcasts {
+		db.podcasts[i].Options = opts[db.podcasts[i].FriendlyName]
+	}
+	db.defaultPodcast.Options = opts[UnknownPodcastName]
+
 	return nil
 }
 
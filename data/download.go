@@ -1,26 +1,18 @@
 package data
 
 import (
-	"net/http"
+	"errors"
+	"fmt"
+	"io"
 	"os"
-	"os/exec"
-	"path/filepath"
 	"runtime"
 	"strconv"
-	"strings"
 	"sync"
 	"time"
 
 	ev "github.com/ejv2/podbit/event"
 )
 
-// YouTube downloading constants.
-const (
-	YoutubeDL    string = "youtube-dl"
-	YoutubeDLP   string = "yt-dlp"
-	YoutubeFlags string = "--add-metadata --newline --no-colors -f bestaudio --extract-audio --audio-format mp3"
-)
-
 // eventInterval is the minimum time between two DownloadChanged events emitted
 // by a downloader goroutine. This is intended to reduce thread contention
 // between these goroutines.
@@ -35,8 +27,13 @@ type Download struct {
 	// Protects this download instance
 	mut *sync.RWMutex
 
+	// ID identifies the download in the downloads table
+	ID int
+
 	// Path is the absolute path of the download destination
 	Path string
+	// URL is where the episode is downloaded from
+	URL string
 	// File is the live file handle of the download
 	// Will be closed once Completed == true
 	File *os.File
@@ -50,10 +47,26 @@ type Download struct {
 	Size int64
 	// Done is the currently downloaded size present on disk
 	Done int64
+	// Rate is the current download speed in bytes per second
+	Rate float64
 
 	// Started is the timestamp of the download commencing
 	Started time.Time
 
+	// Queued == true until the download is started by the scheduler
+	Queued bool
+	// Priority decides the order in which queued downloads are started
+	Priority int
+
+	// Attempts is the number of times the download has been started
+	Attempts int
+	// Status is the HTTP status code of the last response, or zero if there
+	// has been none
+	Status int
+	// NextRetry is the time at which a failed attempt will be retried, or
+	// zero if the download is not waiting to be retried
+	NextRetry time.Time
+
 	// Completed == true once the operations has either finished or failed
 	Completed bool
 	// Success == true if the full download completed successfully
@@ -62,186 +75,149 @@ type Download struct {
 	// Empty if the download did not fail
 	Error string
 
-	// Stop will cause the download to cease immediately
-	// Will be closed once the download completes
-	Stop chan int
+	// Stop is closed to cause the download to cease immediately
+	Stop     chan int
+	stopOnce *sync.Once
+	// cancelled is set once the download is cancelled, so that it is not
+	// retried
+	cancelled bool
+
+	// Limit is the bandwidth limit of this download in bytes per second,
+	// or zero for unlimited. Starts out as DownloadLimit.
+	Limit int64
+	// limit applies Limit
+	limit *bucket
 }
 
-// DownloadYoutube selects an appropriate downloader (yt-dlp or
-// youtube-dl) and begins a YouTube download on the calling thread
-// (synchronously).
-//
-// Used internally by cache; avoid calling directly.
-func (d *Download) DownloadYoutube(hndl ev.Handler) {
-	d.Elem.RLock()
-	if !d.Elem.Youtube {
-		panic("download: downloading non-youtube with youtube-dl")
-	}
-	d.Elem.RUnlock()
-
-	// Work around "already downloaded" errors from youtube-dl
-	d.File.Close()
-	os.Remove(d.File.Name())
-
-	defer func() {
-		Downloads.downloadsMutex.Lock()
-		Downloads.ongoing--
-		Downloads.downloadsMutex.Unlock()
-	}()
-	defer close(d.Stop)
-
-	// Determine downloader program - use yt-dlp if available, else use ytdl
-	loader := ""
-	if _, err := exec.LookPath(YoutubeDLP); err == nil {
-		loader = YoutubeDLP
-	} else if _, err := exec.LookPath(YoutubeDL); err == nil {
-		loader = YoutubeDL
-	} else {
-		d.mut.Lock()
-		d.Completed = true
-		d.Success = false
-		d.Error = "No YouTube downloader"
-		d.mut.Unlock()
+// stop closes the Stop channel, if it has not been already.
+func (d *Download) stop() {
+	d.stopOnce.Do(func() {
+		close(d.Stop)
+	})
+}
 
-		return
-	}
+// isCompleted returns Completed with the download locked.
+func (d *Download) isCompleted() bool {
+	d.mut.RLock()
+	defer d.mut.RUnlock()
 
-	d.Elem.RLock()
-	h, _ := os.UserHomeDir()
-	tmppath := filepath.Join(h, "podbit-ytdl"+strconv.FormatInt(time.Now().UnixMicro(), 10))
-	flags := append(strings.Split(YoutubeFlags, " "), "-o", tmppath+".%(ext)s", d.Elem.URL)
-	d.Elem.RUnlock()
+	return d.Completed
+}
 
-	proc := exec.Command(loader, flags...)
-	r, err := proc.StdoutPipe()
-	if err != nil {
-		d.mut.Lock()
-		d.Completed = true
-		d.Success = false
-		d.Error = "Downloader IO Error"
-		d.mut.Unlock()
+// rateSmoothing is the weight given to each new sample of the download rate,
+// which is averaged to smooth out bursts.
+const rateSmoothing = 0.3
 
-		return
+// sampleRate updates the rolling download rate with a new sample. The
+// download must be locked by the caller.
+func (d *Download) sampleRate(rate float64) {
+	if d.Rate == 0 {
+		d.Rate = rate
+	} else {
+		d.Rate += (rate - d.Rate) * rateSmoothing
 	}
-	proc.Start()
-
-	// NOTE: Do not need to runtime.Gosched here to prevent contention, because IO waiting
-	// occurs on this thread and the runtime will implicitly call it for us when there's no
-	// pending data. Manually calling causes net performance loss
-
-	buf := make([]byte, 4096)
-	lastPost := time.Now()
-	for err == nil {
-		_, err = r.Read(buf)
-		line := string(buf)
-		fields := strings.Fields(line)
-
-		if fields[0] != "[download]" || len(fields) < 2 {
-			continue
-		}
-
-		d.mut.Lock()
-		d.Percentage, _ = strconv.ParseFloat(fields[1][:len(fields[1])-1], 64)
-		d.Percentage /= 100
-		d.mut.Unlock()
-
-		if time.Since(lastPost) >= eventInterval {
-			hndl.Post(ev.DownloadChanged)
-			lastPost = time.Now()
-		}
-
-		select {
-		case <-d.Stop:
-			d.mut.Lock()
-			d.Error = "Cancelled"
-			d.Completed = true
-			d.Success = false
-			d.mut.Unlock()
+}
 
-			r.Close()
-			proc.Process.Kill()
-			return
-		default:
-		}
+// ETA returns the estimated time until the download completes, or zero if
+// it is unknown.
+func (d Download) ETA() time.Duration {
+	if d.Size <= 0 || d.Rate <= 0 || d.Done >= d.Size {
+		return 0
 	}
-	hndl.Post(ev.DownloadChanged)
-	r.Close()
 
-	if err.Error() != "EOF" {
-		d.mut.Lock()
-		d.Completed = true
-		d.Success = false
-		d.Error = "Downloader IO Error"
-		d.mut.Unlock()
-		return
-	}
+	secs := float64(d.Size-d.Done) / d.Rate
+	return time.Duration(secs * float64(time.Second)).Round(time.Second)
+}
 
-	err = proc.Wait()
-	if err != nil {
-		d.mut.Lock()
-		d.Completed = true
-		d.Success = false
-		d.Error = "Download failed"
-		d.mut.Unlock()
-		return
+// FormatSize formats a size in bytes for display.
+func FormatSize(size int64) string {
+	switch {
+	case size >= 1<<30:
+		return fmt.Sprintf("%.1f GB", float64(size)/(1<<30))
+	case size >= 1<<20:
+		return fmt.Sprintf("%.1f MB", float64(size)/(1<<20))
+	case size >= 1<<10:
+		return fmt.Sprintf("%.1f KB", float64(size)/(1<<10))
+	default:
+		return fmt.Sprintf("%d B", size)
 	}
+}
 
-	// Move from temp location
-	os.Rename(tmppath+".mp3", d.Path)
-
-	// Final clean up
-	d.Elem.Lock()
-	d.Elem.State = StateReady
-
-	d.mut.Lock()
-	d.Completed = true
-	d.Success = true
-
-	Downloads.downloadsMutex.Lock()
-	Downloads.loadFile(d.Elem.Path, false)
-	Downloads.downloadsMutex.Unlock()
-
-	d.mut.Unlock()
-	d.Elem.Unlock()
-
-	hndl.Post(ev.DownloadChanged)
+// FormatRate formats a transfer rate in bytes per second for display.
+func FormatRate(rate float64) string {
+	return FormatSize(int64(rate)) + "/s"
 }
 
 // DownloadHTTP connects to the URL of the specified download
 // and downloads to download path on the calling thread
 // (synchronously)
 //
+// The download is written to a partial file, which is renamed to the
+// download path once complete. If the partial file already contains data
+// from an earlier attempt, the download is resumed from where it left off
+// if the server supports it.
+//
 // Used internally by cache; avoid calling directly.
 func (d *Download) DownloadHTTP(hndl ev.Handler) {
 	d.Elem.RLock()
-	resp, err := http.Get(d.Elem.URL)
-	if err != nil || resp.StatusCode != http.StatusOK {
+	part := d.Elem.Path + PartSuffix
+	resp, offset, err := requestHTTP(d.Elem.URL, d.Elem.Path)
+	if err == nil {
+		err = checkContentType(resp.Header.Get("Content-Type"))
+		if err != nil {
+			resp.Body.Close()
+		}
+	}
+	if err != nil {
 		d.mut.Lock()
-		d.Completed = true
-		d.Success = false
-		d.Error = "Download failed"
+		var serr *StatusError
+		if errors.As(err, &serr) {
+			d.Status = serr.Code
+		}
+		d.Error = "Download failed: " + err.Error()
+		retry := d.retryLater(err)
+		if !retry {
+			d.Completed = true
+			d.Success = false
+		}
 		d.mut.Unlock()
 
-		Downloads.downloadsMutex.Lock()
-		Downloads.ongoing--
-		Downloads.downloadsMutex.Unlock()
+		if !retry {
+			Downloads.downloadsMutex.Lock()
+			Downloads.ongoing--
+			Downloads.downloadsMutex.Unlock()
+		}
 
-		os.Remove(d.Elem.Path)
+		// Partial file is kept to be resumed later
+		d.Elem.RUnlock()
+		d.File.Close()
 		hndl.Post(ev.DownloadChanged)
 		return
 	}
 	d.Elem.RUnlock()
 
+	if offset == 0 {
+		d.File.Truncate(0)
+	}
+
 	d.mut.Lock()
+	d.Status = resp.StatusCode
 	size, _ := strconv.ParseInt(resp.Header.Get("Content-Length"), 10, 64)
+	if size > 0 {
+		size += offset
+	}
 	d.Size = size
+	d.Done = offset
 	d.mut.Unlock()
 
+	// A streamed episode keeps the state given by the player
 	d.Elem.Lock()
-	d.Elem.State = StatePending
+	if d.Elem.State != StatePlayed && d.Elem.State != StateFinished {
+		d.Elem.State = StatePending
+	}
 	d.Elem.Unlock()
 
-	var count int64
+	var count, sampled int64
 	var read int
 	dlerr := ""
 	buf := make([]byte, 32*1024) // 32kb
@@ -250,17 +226,37 @@ func (d *Download) DownloadHTTP(hndl ev.Handler) {
 outer:
 	for err == nil {
 		read, err = resp.Body.Read(buf)
-		d.File.WriteAt(buf, count)
+		if _, werr := d.File.WriteAt(buf[:read], offset+count); werr != nil {
+			dlerr = "Write error: " + werr.Error()
+			break
+		}
 		count += int64(read)
 
+		since := time.Since(lastPost)
+
 		d.mut.Lock()
-		d.Done = count
-		d.Percentage = float64(d.Done) / float64(d.Size)
+		d.Done = offset + count
+		if d.Size > 0 {
+			d.Percentage = float64(d.Done) / float64(d.Size)
+		}
+		if since >= eventInterval {
+			d.sampleRate(float64(count-sampled) / since.Seconds())
+		}
 		d.mut.Unlock()
 
-		if time.Since(lastPost) >= eventInterval {
+		if since >= eventInterval {
 			hndl.Post(ev.DownloadChanged)
 			lastPost = time.Now()
+			sampled = count
+		}
+
+		if wait := d.throttle(read); wait > 0 {
+			select {
+			case <-d.Stop:
+				dlerr = "Cancelled"
+				break outer
+			case <-time.After(wait):
+			}
 		}
 
 		if Downloads.Ongoing() > 1 {
@@ -275,17 +271,60 @@ outer:
 		}
 	}
 
+	// Verify the download before it is moved into place
+	var lost error
+	if dlerr == "" {
+		switch {
+		case !errors.Is(err, io.EOF):
+			dlerr = fmt.Sprintf("Connection lost (%s)", err)
+			lost = ErrorConnectionLost
+		case size > 0 && offset+count != size:
+			dlerr = fmt.Sprintf("Incomplete download (%d of %d bytes)", offset+count, size)
+			lost = ErrorConnectionLost
+		default:
+			if verr := checkMagic(part); verr != nil {
+				dlerr = "Verification failed: " + verr.Error()
+
+				// Not worth resuming
+				os.Remove(part)
+				os.Remove(d.Path + PartInfoSuffix)
+			}
+		}
+	}
+
 	d.mut.Lock()
+	if lost != nil && d.retryLater(lost) {
+		// Resumed from the partial file by the next attempt
+		d.Error = dlerr
+		d.mut.Unlock()
+
+		resp.Body.Close()
+		d.File.Close()
+
+		hndl.Post(ev.DownloadChanged)
+		return
+	}
+
 	d.Completed = true
-	if (err != nil && err.Error() != "EOF") || dlerr != "" {
+	if dlerr != "" {
 		d.Success = false
 		d.Error = dlerr
 	} else {
-		d.Success = true
-
-		d.Elem.Lock()
-		d.Elem.State = StateReady
-		d.Elem.Unlock()
+		d.File.Close()
+		if err := os.Rename(part, d.Path); err != nil {
+			d.Success = false
+			d.Error = "IO Error: " + err.Error()
+		} else {
+			d.Success = true
+			d.Error = ""
+			os.Remove(d.Path + PartInfoSuffix)
+
+			d.Elem.Lock()
+			if d.Elem.State == StatePending {
+				d.Elem.State = StateReady
+			}
+			d.Elem.Unlock()
+		}
 	}
 	d.mut.Unlock()
 
@@ -300,5 +339,4 @@ outer:
 	d.File.Close()
 
 	hndl.Post(ev.DownloadChanged)
-	close(d.Stop)
 }
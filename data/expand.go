@@ -0,0 +1,373 @@
+package data
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Playlist expansion errors.
+var (
+	ErrorNoDownloader = errors.New("Error: No YouTube downloader (yt-dlp or youtube-dl) found")
+	ErrorNoEntries    = errors.New("Error: No videos found in playlist")
+)
+
+// WatchFilename is the file name of the list of watched channels on disk.
+const WatchFilename = "watched"
+
+// Playlist expansion configuration.
+var (
+	// ExpandDir is the directory into which videos of expanded playlists
+	// are downloaded.
+	ExpandDir string
+	// ExpandTemplate gives the path of each video relative to ExpandDir.
+	// Fields of the video are substituted for "%(field)s", where field is
+	// one of id, title, uploader, playlist or ext.
+	ExpandTemplate = "%(playlist)s/%(title)s-%(id)s.%(ext)s"
+	// WatchLimit is the number of the latest videos checked for each
+	// watched channel.
+	WatchLimit = 10
+	// WatchInterval is how often watched channels are checked for new
+	// videos, in addition to whenever the queue is reloaded by the user.
+	WatchInterval = time.Hour
+)
+
+func init() {
+	ExpandDir = os.Getenv("PODBIT_DOWNLOAD_PATH")
+	if ExpandDir == "" {
+		home, _ := os.UserHomeDir()
+		ExpandDir = filepath.Join(home, "Downloads", "Podcasts")
+	}
+}
+
+// A PlaylistEntry is a video found in a playlist or channel.
+type PlaylistEntry struct {
+	URL  string
+	Path string
+}
+
+// flatPlaylist is the subset of the JSON printed by YouTube downloaders for
+// a flat playlist.
+type flatPlaylist struct {
+	Title    string `json:"title"`
+	Uploader string `json:"uploader"`
+	Channel  string `json:"channel"`
+	Entries  []struct {
+		Type     string `json:"_type"`
+		IEKey    string `json:"ie_key"`
+		ID       string `json:"id"`
+		URL      string `json:"url"`
+		Title    string `json:"title"`
+		Uploader string `json:"uploader"`
+		Channel  string `json:"channel"`
+	} `json:"entries"`
+}
+
+var templateField = regexp.MustCompile(`%\((\w+)\)s`)
+
+// expandPath fills in the filename template with the given fields. Fields
+// may not contain path separators, and no part of the path may contain
+// spaces or quotes, which cannot be stored in the queue file. Parts made only
+// of dots are replaced, so that the path stays inside ExpandDir.
+func expandPath(fields map[string]string) string {
+	clean := strings.NewReplacer("/", "_", "\\", "_")
+	rel := templateField.ReplaceAllStringFunc(ExpandTemplate, func(match string) string {
+		val := fields[templateField.FindStringSubmatch(match)[1]]
+		if val == "" {
+			val = "NA"
+		}
+
+		return clean.Replace(val)
+	})
+
+	rel = strings.Join(strings.Fields(rel), "_")
+	rel = strings.ReplaceAll(rel, "\"", "")
+
+	parts := strings.Split(rel, "/")
+	for i, part := range parts {
+		if part != "" && strings.Trim(part, ".") == "" {
+			parts[i] = "_"
+		}
+	}
+
+	return filepath.Join(ExpandDir, filepath.Join(parts...))
+}
+
+// channelVideos returns the URL of the videos tab of a YouTube channel, as
+// the channel page itself lists its tabs rather than videos. Other URLs are
+// returned as is.
+func channelVideos(u string) string {
+	parsed, err := url.Parse(u)
+	if err != nil || !strings.HasSuffix(parsed.Hostname(), "youtube.com") {
+		return u
+	}
+
+	parts := strings.Split(strings.Trim(parsed.Path, "/"), "/")
+	switch {
+	case len(parts) == 1 && strings.HasPrefix(parts[0], "@"):
+	case len(parts) == 2 && (parts[0] == "channel" || parts[0] == "c" || parts[0] == "user"):
+	default:
+		return u
+	}
+
+	parsed.Path = strings.TrimSuffix(parsed.Path, "/") + "/videos"
+	return parsed.String()
+}
+
+// videoID returns the ID of a YouTube video from its URL, or an empty string
+// if the URL is not of a YouTube video.
+func videoID(u string) string {
+	parsed, err := url.Parse(u)
+	if err != nil {
+		return ""
+	}
+
+	switch host := parsed.Hostname(); {
+	case host == "youtu.be":
+		return strings.Trim(parsed.Path, "/")
+	case strings.HasSuffix(host, "youtube.com"):
+		if id := parsed.Query().Get("v"); id != "" {
+			return id
+		}
+		if rest := strings.TrimPrefix(parsed.Path, "/shorts/"); rest != parsed.Path {
+			return strings.Trim(rest, "/")
+		}
+	}
+
+	return ""
+}
+
+// youtubeLoader returns the name of the YouTube downloader to use, preferring
+// yt-dlp, or an empty string if neither is installed.
+func youtubeLoader() string {
+	if _, err := exec.LookPath(YoutubeDLP); err == nil {
+		return YoutubeDLP
+	}
+	if _, err := exec.LookPath(YoutubeDL); err == nil {
+		return YoutubeDL
+	}
+
+	return ""
+}
+
+// ListPlaylist lists the videos of a YouTube playlist or channel, newest
+// first for channels, along with the path to which each is downloaded. If
+// limit is above zero, only the first limit videos are listed.
+func ListPlaylist(u string, limit int) ([]PlaylistEntry, error) {
+	loader := youtubeLoader()
+	if loader == "" {
+		return nil, ErrorNoDownloader
+	}
+
+	args := []string{"--flat-playlist", "-J", "--no-warnings", "--user-agent", UserAgent}
+	if Proxy != "" {
+		args = append(args, "--proxy", Proxy)
+	}
+	if limit > 0 {
+		args = append(args, "--playlist-end", strconv.Itoa(limit))
+	}
+	args = append(args, "--", channelVideos(u))
+
+	out, err := exec.Command(loader, args...).Output()
+	if err != nil {
+		var exit *exec.ExitError
+		if errors.As(err, &exit) && len(exit.Stderr) > 0 {
+			return nil, fmt.Errorf("Error: Failed to list playlist: %s", strings.TrimSpace(string(exit.Stderr)))
+		}
+
+		return nil, fmt.Errorf("Error: Failed to list playlist: %w", err)
+	}
+
+	var pl flatPlaylist
+	if err := json.Unmarshal(out, &pl); err != nil {
+		return nil, fmt.Errorf("Error: Failed to read playlist: %w", err)
+	}
+
+	var entries []PlaylistEntry
+	for _, elem := range pl.Entries {
+		// Nested playlists, such as the tabs of a channel, are not videos
+		if elem.Type == "playlist" || elem.IEKey == "YoutubeTab" {
+			continue
+		}
+
+		link := elem.URL
+		if elem.IEKey == "Youtube" && elem.ID != "" {
+			link = "https://www.youtube.com/watch?v=" + elem.ID
+		}
+		if link == "" {
+			continue
+		}
+
+		uploader := elem.Uploader
+		for _, alt := range []string{elem.Channel, pl.Uploader, pl.Channel} {
+			if uploader == "" {
+				uploader = alt
+			}
+		}
+
+		entries = append(entries, PlaylistEntry{
+			URL: link,
+			Path: expandPath(map[string]string{
+				"id":       elem.ID,
+				"title":    elem.Title,
+				"uploader": uploader,
+				"playlist": pl.Title,
+				"ext":      YoutubeAudio,
+			}),
+		})
+	}
+
+	if len(entries) == 0 {
+		return nil, ErrorNoEntries
+	}
+
+	return entries, nil
+}
+
+// Add appends entries to be downloaded by the YouTube downloader to the
+// queue, both in memory and in the queue file. Entries already in the queue
+// are skipped. Returns the number of entries added.
+func (q *Queue) Add(entries []PlaylistEntry) (int, error) {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+
+	// The same video may be queued under a different URL
+	ids := make(map[string]bool)
+	for link := range q.Linkmap {
+		if id := videoID(link); id != "" {
+			ids[id] = true
+		}
+	}
+
+	file, err := os.OpenFile(q.path, os.O_WRONLY|os.O_APPEND, os.ModePerm)
+	if err != nil {
+		return 0, ErrorIOFailed
+	}
+	defer file.Close()
+
+	added := 0
+	for _, elem := range entries {
+		id := videoID(elem.URL)
+		if _, ok := q.Linkmap[elem.URL]; ok || (id != "" && ids[id]) {
+			continue
+		}
+
+		if _, err := fmt.Fprintf(file, "+%s \"%s\"\n", elem.URL, elem.Path); err != nil {
+			return added, ErrorIOFailed
+		}
+
+		item := &QueueItem{
+			RWMutex: new(sync.RWMutex),
+			URL:     elem.URL,
+			Path:    elem.Path,
+			State:   StatePending,
+			Youtube: true,
+		}
+		pod := DB.GetOwner(item.URL)
+
+		q.Items = append(q.Items, item)
+		q.Linkmap[item.URL] = item
+		q.Podmap[pod.FriendlyName] = append(q.Podmap[pod.FriendlyName], item)
+		if id != "" {
+			ids[id] = true
+		}
+		added++
+	}
+
+	return added, nil
+}
+
+// ExpandPlaylist adds the videos of a YouTube playlist or channel to the
+// queue, returning the number added. If watch is true, the playlist is also
+// watched for new videos.
+func ExpandPlaylist(u string, watch bool) (int, error) {
+	entries, err := ListPlaylist(u, 0)
+	if err != nil {
+		return 0, err
+	}
+
+	added, err := Q.Add(entries)
+	if err != nil {
+		return added, err
+	}
+
+	if watch {
+		err = Watch(u)
+	}
+
+	return added, err
+}
+
+// Watched returns the URLs of the watched playlists and channels.
+func Watched() []string {
+	f, err := os.Open(DataPath(WatchFilename))
+	if err != nil {
+		return nil
+	}
+	defer f.Close()
+
+	var urls []string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		if line := strings.TrimSpace(scanner.Text()); line != "" && !strings.HasPrefix(line, "#") {
+			urls = append(urls, line)
+		}
+	}
+
+	return urls
+}
+
+// Watch adds a playlist or channel to the watched list, if it is not already
+// watched.
+func Watch(u string) error {
+	for _, elem := range Watched() {
+		if elem == u {
+			return nil
+		}
+	}
+
+	f, err := os.OpenFile(DataPath(WatchFilename), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return fmt.Errorf("Error: Failed to save watched channels: %w", err)
+	}
+	defer f.Close()
+
+	_, err = fmt.Fprintln(f, u)
+	return err
+}
+
+// watchMutex prevents watched channels being checked twice at once.
+var watchMutex sync.Mutex
+
+// RefreshWatched adds the latest videos of each watched playlist or channel
+// to the queue, returning the number added. If watched channels are already
+// being checked, nothing is done.
+func RefreshWatched() int {
+	if !watchMutex.TryLock() {
+		return 0
+	}
+	defer watchMutex.Unlock()
+
+	added := 0
+	for _, elem := range Watched() {
+		entries, err := ListPlaylist(elem, WatchLimit)
+		if err != nil {
+			continue
+		}
+
+		n, _ := Q.Add(entries)
+		added += n
+	}
+
+	return added
+}
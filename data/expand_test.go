@@ -0,0 +1,100 @@
+package data_test
+
+import (
+	"testing"
+
+	"github.com/ejv2/podbit/data"
+)
+
+var VideoIDTests = []struct {
+	URL, ID string
+}{
+	{"https://www.youtube.com/watch?v=dQw4w9WgXcQ", "dQw4w9WgXcQ"},
+	{"https://youtube.com/watch?v=dQw4w9WgXcQ&list=PL123", "dQw4w9WgXcQ"},
+	{"https://m.youtube.com/watch?v=dQw4w9WgXcQ", "dQw4w9WgXcQ"},
+	{"https://youtu.be/dQw4w9WgXcQ", "dQw4w9WgXcQ"},
+	{"https://www.youtube.com/shorts/dQw4w9WgXcQ", "dQw4w9WgXcQ"},
+	{"https://www.youtube.com/@channel", ""},
+	{"https://example.com/watch?v=dQw4w9WgXcQ", ""},
+	{"https://example.com/episode.mp3", ""},
+}
+
+var ChannelTests = []struct {
+	URL, Expects string
+}{
+	{"https://www.youtube.com/@channel", "https://www.youtube.com/@channel/videos"},
+	{"https://www.youtube.com/@channel/", "https://www.youtube.com/@channel/videos"},
+	{"https://www.youtube.com/channel/UC123", "https://www.youtube.com/channel/UC123/videos"},
+	{"https://www.youtube.com/c/name", "https://www.youtube.com/c/name/videos"},
+	{"https://www.youtube.com/user/name", "https://www.youtube.com/user/name/videos"},
+	{"https://www.youtube.com/@channel/streams", "https://www.youtube.com/@channel/streams"},
+	{"https://www.youtube.com/playlist?list=PL123", "https://www.youtube.com/playlist?list=PL123"},
+	{"https://example.com/@channel", "https://example.com/@channel"},
+}
+
+var ExpandPathTests = []struct {
+	Template string
+	Fields   map[string]string
+	Expects  string
+}{
+	{
+		"%(playlist)s/%(title)s-%(id)s.%(ext)s",
+		map[string]string{"playlist": "My List", "title": "Episode 1", "id": "abc", "ext": "mp3"},
+		"/dl/My_List/Episode_1-abc.mp3",
+	},
+	{
+		"%(uploader)s/%(title)s.%(ext)s",
+		map[string]string{"uploader": "A/B", "title": "Say \"hi\"", "ext": "mp3"},
+		"/dl/A_B/Say_hi.mp3",
+	},
+	{
+		"%(playlist)s/%(title)s",
+		map[string]string{"title": "x"},
+		"/dl/NA/x",
+	},
+	{
+		"%(playlist)s/%(title)s",
+		map[string]string{"playlist": "..", "title": "."},
+		"/dl/_/_",
+	},
+	{
+		"../%(title)s",
+		map[string]string{"title": "..."},
+		"/dl/_/_",
+	},
+}
+
+// TestVideoID tests finding the ID of a YouTube video from its URL.
+func TestVideoID(t *testing.T) {
+	for _, elem := range VideoIDTests {
+		if id := data.VideoID(elem.URL); id != elem.ID {
+			t.Errorf("url %q: expected id %q, got %q", elem.URL, elem.ID, id)
+		}
+	}
+}
+
+// TestChannelVideos tests that channel URLs are pointed at their videos.
+func TestChannelVideos(t *testing.T) {
+	for _, elem := range ChannelTests {
+		if u := data.ChannelVideos(elem.URL); u != elem.Expects {
+			t.Errorf("url %q: expected %q, got %q", elem.URL, elem.Expects, u)
+		}
+	}
+}
+
+// TestExpandPath tests filling in the filename template for videos of an
+// expanded playlist.
+func TestExpandPath(t *testing.T) {
+	dir, template := data.ExpandDir, data.ExpandTemplate
+	defer func() {
+		data.ExpandDir, data.ExpandTemplate = dir, template
+	}()
+	data.ExpandDir = "/dl"
+
+	for _, elem := range ExpandPathTests {
+		data.ExpandTemplate = elem.Template
+		if path := data.ExpandPath(elem.Fields); path != elem.Expects {
+			t.Errorf("template %q: expected %q, got %q", elem.Template, elem.Expects, path)
+		}
+	}
+}
@@ -0,0 +1,33 @@
+package data
+
+import "sync"
+
+// Internals exported for testing.
+var (
+	CheckContentType = checkContentType
+	CheckMagic       = checkMagic
+	ExpandPath       = expandPath
+	VideoID          = videoID
+	ChannelVideos    = channelVideos
+	RetryAfter       = retryAfter
+	Backoff          = backoff
+	Transient        = transient
+	RequestHTTP      = requestHTTP
+	ParseSize        = parseSize
+	ParseLogEntry    = parseLogEntry
+)
+
+// ParseLines feeds lines of YouTube downloader output to a new download,
+// returning the download and the last error reported.
+func ParseLines(lines []string) (Download, string) {
+	d := Download{mut: new(sync.RWMutex)}
+
+	var msg string
+	for _, line := range lines {
+		if m := d.parseLine(line); m != "" {
+			msg = m
+		}
+	}
+
+	return d, msg
+}
@@ -0,0 +1,160 @@
+package data
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// HistoryFilename is the file name of the download log on disk.
+const HistoryFilename = "downloads.log"
+
+// MaxHistory is the number of entries kept in the download log. Older
+// entries are removed when podbit starts.
+var MaxHistory = 1000
+
+// Download outcomes, as recorded in the download log.
+const (
+	OutcomeFinished  = "finished"
+	OutcomeFailed    = "failed"
+	OutcomeCancelled = "cancelled"
+)
+
+// LogEntry is a record of a finished download in the download log.
+type LogEntry struct {
+	// Time is when the download finished
+	Time time.Time
+	// URL is where the episode was downloaded from
+	URL string
+	// Path is where the episode was downloaded to
+	Path string
+	// Bytes is the number of bytes downloaded
+	Bytes int64
+	// Duration is the time taken by the last attempt at the download
+	Duration time.Duration
+	// Outcome is one of the Outcome constants
+	Outcome string
+	// Error is the reason the download failed, if it did
+	Error string
+}
+
+// String formats the entry as a line of the download log.
+func (e LogEntry) String() string {
+	// Fields are tab separated, so cannot contain tabs or newlines
+	clean := strings.NewReplacer("\t", " ", "\n", " ").Replace
+
+	return fmt.Sprintf("%s\t%s\t%d\t%d\t%s\t%s\t%s",
+		e.Time.Format(time.RFC3339), e.Outcome, e.Bytes, e.Duration.Milliseconds(),
+		clean(e.URL), clean(e.Path), clean(e.Error))
+}
+
+// parseLogEntry parses a line of the download log.
+func parseLogEntry(line string) (e LogEntry, ok bool) {
+	fields := strings.Split(line, "\t")
+	if len(fields) != 7 {
+		return e, false
+	}
+
+	var err error
+	if e.Time, err = time.Parse(time.RFC3339, fields[0]); err != nil {
+		return e, false
+	}
+	if e.Bytes, err = strconv.ParseInt(fields[2], 10, 64); err != nil {
+		return e, false
+	}
+	ms, err := strconv.ParseInt(fields[3], 10, 64)
+	if err != nil {
+		return e, false
+	}
+
+	e.Outcome = fields[1]
+	e.Duration = time.Duration(ms) * time.Millisecond
+	e.URL, e.Path, e.Error = fields[4], fields[5], fields[6]
+
+	return e, true
+}
+
+// loadHistory reads the download log, removing the oldest entries if there
+// are more than MaxHistory. A missing log is not an error.
+func (c *Cache) loadHistory() {
+	c.historyMutex.Lock()
+	defer c.historyMutex.Unlock()
+
+	path := DataPath(HistoryFilename)
+	f, err := os.Open(path)
+	if err != nil {
+		return
+	}
+
+	c.history = nil
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		if e, ok := parseLogEntry(scanner.Text()); ok {
+			c.history = append(c.history, e)
+		}
+	}
+	f.Close()
+
+	if len(c.history) <= MaxHistory {
+		return
+	}
+	c.history = c.history[len(c.history)-MaxHistory:]
+
+	f, err = os.Create(path)
+	if err != nil {
+		return
+	}
+	defer f.Close()
+
+	for _, e := range c.history {
+		fmt.Fprintln(f, e)
+	}
+}
+
+// logDownload records a finished download in the download log.
+func (c *Cache) logDownload(dl *Download) {
+	dl.mut.RLock()
+	e := LogEntry{
+		Time:     time.Now(),
+		URL:      dl.URL,
+		Path:     dl.Path,
+		Bytes:    dl.Done,
+		Duration: time.Since(dl.Started),
+		Outcome:  OutcomeFinished,
+	}
+	if !dl.Success {
+		e.Outcome = OutcomeFailed
+		if dl.Error == "Cancelled" {
+			e.Outcome = OutcomeCancelled
+		}
+		e.Error = dl.Error
+	}
+	dl.mut.RUnlock()
+
+	c.historyMutex.Lock()
+	defer c.historyMutex.Unlock()
+
+	c.history = append(c.history, e)
+	if len(c.history) > MaxHistory {
+		c.history = c.history[len(c.history)-MaxHistory:]
+	}
+
+	f, err := os.OpenFile(DataPath(HistoryFilename), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return
+	}
+	defer f.Close()
+
+	fmt.Fprintln(f, e)
+}
+
+// History returns the entries of the download log, oldest first.
+func (c *Cache) History() []LogEntry {
+	c.historyMutex.Lock()
+	defer c.historyMutex.Unlock()
+
+	return append([]LogEntry(nil), c.history...)
+}
@@ -0,0 +1,85 @@
+package data_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/ejv2/podbit/data"
+)
+
+var LogEntryTests = []struct {
+	Entry   data.LogEntry
+	Expects data.LogEntry
+}{
+	{
+		data.LogEntry{
+			Time:     time.Date(2024, time.March, 10, 12, 30, 0, 0, time.UTC),
+			URL:      "https://example.com/ep1.mp3",
+			Path:     "/podcasts/ep1.mp3",
+			Bytes:    1234567,
+			Duration: 1500 * time.Millisecond,
+			Outcome:  data.OutcomeFinished,
+		},
+		data.LogEntry{},
+	},
+	{
+		data.LogEntry{
+			Time:     time.Date(2024, time.March, 10, 12, 30, 0, 0, time.UTC),
+			URL:      "https://example.com/ep2.mp3",
+			Path:     "/podcasts/ep2.mp3",
+			Duration: 20 * time.Second,
+			Outcome:  data.OutcomeFailed,
+			Error:    "Download failed:\tbad\nthings",
+		},
+		data.LogEntry{
+			Time:     time.Date(2024, time.March, 10, 12, 30, 0, 0, time.UTC),
+			URL:      "https://example.com/ep2.mp3",
+			Path:     "/podcasts/ep2.mp3",
+			Duration: 20 * time.Second,
+			Outcome:  data.OutcomeFailed,
+			Error:    "Download failed: bad things",
+		},
+	},
+}
+
+var LogEntryErrors = []string{
+	"",
+	"2024-03-10T12:30:00Z\tfinished\t1\t1\turl\tpath",
+	"yesterday\tfinished\t1\t1\turl\tpath\t",
+	"2024-03-10T12:30:00Z\tfinished\tmany\t1\turl\tpath\t",
+	"2024-03-10T12:30:00Z\tfinished\t1\tlong\turl\tpath\t",
+}
+
+// TestLogEntry tests that download log entries are read back as written,
+// with tabs and newlines removed from fields.
+func TestLogEntry(t *testing.T) {
+	for _, elem := range LogEntryTests {
+		expects := elem.Expects
+		if expects == (data.LogEntry{}) {
+			expects = elem.Entry
+		}
+
+		e, ok := data.ParseLogEntry(elem.Entry.String())
+		if !ok {
+			t.Errorf("entry %q: failed to parse", elem.Entry.String())
+			continue
+		}
+		if !e.Time.Equal(expects.Time) {
+			t.Errorf("entry %q: expected time %s, got %s", elem.Entry.String(), expects.Time, e.Time)
+		}
+
+		e.Time = expects.Time
+		if e != expects {
+			t.Errorf("entry %q: expected %+v, got %+v", elem.Entry.String(), expects, e)
+		}
+	}
+}
+
+// TestLogEntryErrors tests that malformed download log lines are skipped.
+func TestLogEntryErrors(t *testing.T) {
+	for _, elem := range LogEntryErrors {
+		if _, ok := data.ParseLogEntry(elem); ok {
+			t.Errorf("entry %q: expected failure to parse", elem)
+		}
+	}
+}
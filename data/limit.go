@@ -0,0 +1,182 @@
+package data
+
+import (
+	"errors"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrorWindowSyntax is returned when parsing an invalid set of download
+// windows.
+var ErrorWindowSyntax = errors.New("Error: Malformed download windows: expected \"<start>-<end>\" times such as \"01:00-06:00\"")
+
+// Bandwidth limits, in bytes per second. Zero is unlimited.
+var (
+	// RateLimit is shared between all downloads.
+	RateLimit int64 = 0
+	// DownloadLimit applies to each download separately, unless changed
+	// for a download with SetLimit.
+	DownloadLimit int64 = 0
+)
+
+// DownloadWindows are the times of day during which downloads may start. If
+// there are none, downloads may start at any time.
+var DownloadWindows []Window
+
+// A Window is a time of day between Start and End, as offsets from midnight.
+// If End is before Start, the window continues past midnight.
+type Window struct {
+	Start time.Duration
+	End   time.Duration
+}
+
+// parseClock parses a time of day in the format "15:04".
+func parseClock(s string) (time.Duration, error) {
+	t, err := time.Parse("15:04", strings.TrimSpace(s))
+	if err != nil {
+		return 0, ErrorWindowSyntax
+	}
+
+	return time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute, nil
+}
+
+// ParseWindows parses a comma separated list of download windows, each a
+// start and end time of day separated by a dash, such as:
+//
+//	01:00-06:00,22:30-23:30
+func ParseWindows(s string) ([]Window, error) {
+	var windows []Window
+
+	for _, elem := range strings.Split(s, ",") {
+		pair := strings.SplitN(elem, "-", 2)
+		if len(pair) != 2 {
+			return nil, ErrorWindowSyntax
+		}
+
+		var w Window
+		var err error
+		if w.Start, err = parseClock(pair[0]); err != nil {
+			return nil, err
+		}
+		if w.End, err = parseClock(pair[1]); err != nil {
+			return nil, err
+		}
+		if w.Start == w.End {
+			return nil, ErrorWindowSyntax
+		}
+
+		windows = append(windows, w)
+	}
+
+	return windows, nil
+}
+
+// sinceMidnight returns the time of day of t.
+func sinceMidnight(t time.Time) time.Duration {
+	y, m, d := t.Date()
+	return t.Sub(time.Date(y, m, d, 0, 0, 0, 0, t.Location()))
+}
+
+// Contains returns true if t falls within the window.
+func (w Window) Contains(t time.Time) bool {
+	now := sinceMidnight(t)
+	if w.Start < w.End {
+		return now >= w.Start && now < w.End
+	}
+
+	return now >= w.Start || now < w.End
+}
+
+// WindowOpen returns true if downloads may start at t.
+func WindowOpen(t time.Time) bool {
+	if len(DownloadWindows) == 0 {
+		return true
+	}
+
+	for _, w := range DownloadWindows {
+		if w.Contains(t) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// NextWindow returns the time at which the next download window opens after
+// t.
+func NextWindow(t time.Time) time.Time {
+	now := sinceMidnight(t)
+	midnight := t.Add(-now)
+
+	var next time.Time
+	for _, w := range DownloadWindows {
+		start := midnight.Add(w.Start)
+		if w.Start <= now {
+			start = start.AddDate(0, 0, 1)
+		}
+
+		if next.IsZero() || start.Before(next) {
+			next = start
+		}
+	}
+
+	return next
+}
+
+// A bucket limits the rate at which bytes are transferred. Tokens are added
+// at the rate limit, up to one second's worth, and removed as bytes are
+// transferred. Transfers may take more than are available, in which case the
+// transfer must wait until the bucket is refilled.
+type bucket struct {
+	mut    sync.Mutex
+	tokens float64
+	last   time.Time
+}
+
+// take removes n bytes from the bucket with the given rate limit, returning
+// how long the caller must wait before transferring them.
+func (b *bucket) take(rate int64, n int) time.Duration {
+	if b == nil || rate <= 0 {
+		return 0
+	}
+
+	b.mut.Lock()
+	defer b.mut.Unlock()
+
+	now := time.Now()
+	if b.last.IsZero() {
+		b.tokens = float64(rate)
+	} else {
+		b.tokens += now.Sub(b.last).Seconds() * float64(rate)
+	}
+	if b.tokens > float64(rate) {
+		b.tokens = float64(rate)
+	}
+	b.last = now
+
+	b.tokens -= float64(n)
+	if b.tokens >= 0 {
+		return 0
+	}
+
+	return time.Duration(-b.tokens / float64(rate) * float64(time.Second))
+}
+
+// shared limits the total rate of all downloads.
+var shared bucket
+
+// throttle returns how long a download must wait before writing n more bytes
+// to keep within the bandwidth limits.
+func (d *Download) throttle(n int) time.Duration {
+	d.mut.RLock()
+	limit := d.Limit
+	d.mut.RUnlock()
+
+	wait := shared.take(RateLimit, n)
+	if each := d.limit.take(limit, n); each > wait {
+		wait = each
+	}
+
+	return wait
+}
@@ -0,0 +1,73 @@
+package data_test
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/ejv2/podbit/data"
+)
+
+var WindowTests = []struct {
+	Windows string
+	Time    string
+	Open    bool
+	Next    string
+}{
+	{"01:00-06:00", "00:59", false, "01:00"},
+	{"01:00-06:00", "01:00", true, "01:00"},
+	{"01:00-06:00", "05:59", true, "01:00"},
+	{"01:00-06:00", "06:00", false, "01:00"},
+	{"22:00-02:00", "23:30", true, "22:00"},
+	{"22:00-02:00", "01:30", true, "22:00"},
+	{"22:00-02:00", "12:00", false, "22:00"},
+	{"01:00-06:00, 13:00-14:00", "10:00", false, "13:00"},
+	{"01:00-06:00, 13:00-14:00", "13:30", true, "01:00"},
+}
+
+var WindowErrors = []string{
+	"",
+	"01:00",
+	"01:00-",
+	"1am-6am",
+	"25:00-06:00",
+	"01:00-01:00",
+	"01:00-06:00,",
+}
+
+// TestWindows tests parsing of download windows and checking whether they
+// are open.
+func TestWindows(t *testing.T) {
+	day := time.Date(2024, time.March, 10, 0, 0, 0, 0, time.UTC)
+
+	for _, elem := range WindowTests {
+		windows, err := data.ParseWindows(elem.Windows)
+		if err != nil {
+			t.Errorf("windows %q: unexpected error: %s", elem.Windows, err)
+			continue
+		}
+		data.DownloadWindows = windows
+
+		clock, _ := time.Parse("15:04", elem.Time)
+		now := day.Add(time.Duration(clock.Hour())*time.Hour + time.Duration(clock.Minute())*time.Minute)
+
+		if open := data.WindowOpen(now); open != elem.Open {
+			t.Errorf("windows %q at %s: expected open %t, got %t", elem.Windows, elem.Time, elem.Open, open)
+		}
+		if next := data.NextWindow(now).Format("15:04"); next != elem.Next {
+			t.Errorf("windows %q at %s: expected next window at %s, got %s", elem.Windows, elem.Time, elem.Next, next)
+		}
+	}
+
+	data.DownloadWindows = nil
+}
+
+// TestWindowErrors tests that invalid download windows are rejected.
+func TestWindowErrors(t *testing.T) {
+	for _, elem := range WindowErrors {
+		_, err := data.ParseWindows(elem)
+		if !errors.Is(err, data.ErrorWindowSyntax) {
+			t.Errorf("windows %q: expected syntax error, got %v", elem, err)
+		}
+	}
+}
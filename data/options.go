@@ -0,0 +1,165 @@
+package data
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// OptionsFilename is the file name of the per-podcast options file on disk.
+const OptionsFilename = "podcasts"
+
+// Options-related error values.
+var (
+	ErrorOptionsIOFailed = errors.New("Error: IO error while reading from podcast options file")
+	ErrorOptionsSyntax   = "Error: Malformed podcast options: %s on line %d"
+)
+
+// PodcastOptions are the user-configured settings for a single podcast, as
+// read from the podcast options file.
+//
+// The options file is made up of sections headed by the friendly name of a
+// podcast in square brackets, followed by "key = value" pairs which apply to
+// that podcast. For example:
+//
+//	[Some Podcast]
+//	filters = loudnorm,silence
+//	header = X-Token: secret
+type PodcastOptions struct {
+	// Filters is the chain of audio filters to apply when playing episodes
+	// of this podcast. A nil chain means the global chain should be used,
+	// whereas an empty chain means no filters at all.
+	Filters []string
+	// Intro is the number of seconds at the start of each episode which
+	// should be skipped.
+	Intro int
+	// Outro is the number of seconds at the end of each episode which
+	// should be skipped. Episodes are finished once they reach the outro.
+	Outro int
+	// Headers are extra HTTP headers sent when downloading episodes of this
+	// podcast.
+	Headers map[string]string
+	// Username and Password are sent using HTTP basic authentication when
+	// downloading episodes of this podcast, if either is set.
+	Username string
+	Password string
+}
+
+// parseList parses a comma separated list of values. The special value "none"
+// is an explicitly empty list.
+func parseList(val string) []string {
+	list := make([]string, 0)
+	if val == "none" {
+		return list
+	}
+
+	for _, elem := range strings.Split(val, ",") {
+		elem = strings.TrimSpace(elem)
+		if elem != "" {
+			list = append(list, elem)
+		}
+	}
+
+	return list
+}
+
+// parseSeconds parses a non-negative number of seconds.
+func parseSeconds(val string) (int, error) {
+	secs, err := strconv.Atoi(val)
+	if err != nil || secs < 0 {
+		return 0, fmt.Errorf("invalid number of seconds %q", val)
+	}
+
+	return secs, nil
+}
+
+// set parses a single "key = value" pair into the options.
+func (o *PodcastOptions) set(key, val string) (err error) {
+	switch key {
+	case "filters":
+		o.Filters = parseList(val)
+	case "intro":
+		o.Intro, err = parseSeconds(val)
+	case "outro":
+		o.Outro, err = parseSeconds(val)
+	case "header":
+		fields := strings.SplitN(val, ":", 2)
+		if len(fields) < 2 || strings.TrimSpace(fields[0]) == "" {
+			return fmt.Errorf("expected header \"name: value\", got %q", val)
+		}
+
+		if o.Headers == nil {
+			o.Headers = make(map[string]string)
+		}
+		o.Headers[strings.TrimSpace(fields[0])] = strings.TrimSpace(fields[1])
+	case "auth":
+		fields := strings.SplitN(val, ":", 2)
+		if len(fields) < 2 {
+			return errors.New("expected credentials \"user:password\"")
+		}
+
+		o.Username, o.Password = fields[0], fields[1]
+	default:
+		return fmt.Errorf("unknown option %q", key)
+	}
+
+	return
+}
+
+// readOptions reads the podcast options file at path, returning a map of
+// friendly names to their configured options. A missing file is not an
+// error.
+func readOptions(path string) (map[string]PodcastOptions, error) {
+	opts := make(map[string]PodcastOptions)
+
+	file, err := os.Open(path)
+	if err != nil {
+		return opts, nil
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	scanner.Split(bufio.ScanLines)
+
+	section := ""
+	for i := 1; scanner.Scan(); i++ {
+		if scanner.Err() != nil {
+			return nil, ErrorOptionsIOFailed
+		}
+
+		elem := strings.TrimSpace(scanner.Text())
+		if len(elem) == 0 || strings.HasPrefix(elem, "#") {
+			continue
+		}
+
+		if strings.HasPrefix(elem, "[") {
+			if !strings.HasSuffix(elem, "]") {
+				return nil, fmt.Errorf(ErrorOptionsSyntax, "unterminated podcast name", i)
+			}
+
+			section = strings.TrimSpace(elem[1 : len(elem)-1])
+			continue
+		}
+
+		if section == "" {
+			return nil, fmt.Errorf(ErrorOptionsSyntax, "option outside of podcast section", i)
+		}
+
+		fields := strings.SplitN(elem, "=", 2)
+		if len(fields) < 2 {
+			return nil, fmt.Errorf(ErrorOptionsSyntax, "expected \"key = value\"", i)
+		}
+
+		o := opts[section]
+		err := o.set(strings.TrimSpace(fields[0]), strings.TrimSpace(fields[1]))
+		if err != nil {
+			return nil, fmt.Errorf(ErrorOptionsSyntax, err.Error(), i)
+		}
+		opts[section] = o
+	}
+
+	return opts, nil
+}
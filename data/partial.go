@@ -0,0 +1,108 @@
+package data
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+)
+
+const (
+	// PartSuffix is appended to the path of an episode to give the path of
+	// the partial file to which it is downloaded.
+	PartSuffix = ".part"
+	// PartInfoSuffix is appended to the path of an episode to give the path
+	// of the file storing the validator of a partial download, which is used
+	// to check that the episode has not changed when resuming.
+	PartInfoSuffix = ".part.info"
+)
+
+// ErrorDownloadStatus is returned when the server responds to a download
+// request with an unexpected status.
+var ErrorDownloadStatus = errors.New("unexpected response status")
+
+// validator returns the value used in an If-Range header to check that a
+// resource is unchanged, or an empty string if the response has none. Weak
+// entity tags cannot be used for ranges.
+func validator(h http.Header) string {
+	if etag := h.Get("ETag"); etag != "" && !strings.HasPrefix(etag, "W/") {
+		return etag
+	}
+
+	return h.Get("Last-Modified")
+}
+
+// rangeStart returns the first byte of a Content-Range header.
+func rangeStart(header string) (int64, bool) {
+	header = strings.TrimPrefix(header, "bytes ")
+	dash := strings.IndexByte(header, '-')
+	if dash < 0 {
+		return 0, false
+	}
+
+	start, err := strconv.ParseInt(header[:dash], 10, 64)
+	return start, err == nil
+}
+
+// requestHTTP requests the episode at url for download to path. If a partial
+// download exists with a validator, only the remainder is requested, unless
+// the episode has changed since. Returns the response and the offset into
+// the episode at which its body starts.
+func requestHTTP(url, path string) (*http.Response, int64, error) {
+	var offset int64
+	if stat, err := os.Stat(path + PartSuffix); err == nil {
+		offset = stat.Size()
+	}
+
+	info, _ := os.ReadFile(path + PartInfoSuffix)
+	valid := strings.TrimSpace(string(info))
+
+	// Try resuming first, then start again from the beginning
+	for attempt := 0; attempt < 2; attempt++ {
+		req, err := newRequest(url)
+		if err != nil {
+			return nil, 0, err
+		}
+
+		ranged := attempt == 0 && offset > 0 && valid != ""
+		if ranged {
+			req.Header.Set("Range", fmt.Sprintf("bytes=%d-", offset))
+			req.Header.Set("If-Range", valid)
+		}
+
+		resp, err := client.Do(req)
+		if err != nil {
+			return nil, 0, err
+		}
+
+		switch resp.StatusCode {
+		case http.StatusPartialContent:
+			if start, ok := rangeStart(resp.Header.Get("Content-Range")); ranged && ok && start == offset {
+				return resp, offset, nil
+			}
+		case http.StatusOK:
+			// Resource changed or ranges unsupported: the whole episode
+			if v := validator(resp.Header); v != "" {
+				os.WriteFile(path+PartInfoSuffix, []byte(v+"\n"), 0666)
+			} else {
+				os.Remove(path + PartInfoSuffix)
+			}
+
+			return resp, 0, nil
+		case http.StatusRequestedRangeNotSatisfiable:
+		default:
+			resp.Body.Close()
+			return nil, 0, &StatusError{
+				Code:       resp.StatusCode,
+				Status:     resp.Status,
+				RetryAfter: retryAfter(resp.Header),
+			}
+		}
+
+		resp.Body.Close()
+	}
+
+	return nil, 0, ErrorDownloadStatus
+}
@@ -0,0 +1,98 @@
+package data_test
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ejv2/podbit/data"
+)
+
+// episodeBody is the content served as an episode.
+var episodeBody = []byte("ID3 this is the content of a podcast episode")
+
+var ResumeTests = []struct {
+	Name string
+	// Part is the partial download already on disk, if any
+	Part string
+	// Info is the validator stored for the partial download, if any
+	Info string
+	// Missing serves a 404 instead of the episode
+	Missing bool
+
+	Offset int64
+	Range  bool
+	Status int
+}{
+	{Name: "fresh", Offset: 0},
+	{Name: "resume", Part: "ID3 this is", Info: `"v1"`, Offset: 11, Range: true},
+	{Name: "changed", Part: "ID3 this is", Info: `"v0"`, Offset: 0, Range: true},
+	{Name: "no validator", Part: "ID3 this is", Offset: 0},
+	{Name: "missing", Missing: true, Status: http.StatusNotFound},
+}
+
+// TestRequestHTTP tests that partial downloads are resumed with a range
+// request only if the episode has not changed.
+func TestRequestHTTP(t *testing.T) {
+	var ranged bool
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ranged = r.Header.Get("Range") != ""
+		if strings.HasSuffix(r.URL.Path, "missing") {
+			http.NotFound(w, r)
+			return
+		}
+
+		w.Header().Set("ETag", `"v1"`)
+		http.ServeContent(w, r, "episode.mp3", time.Time{}, bytes.NewReader(episodeBody))
+	}))
+	defer srv.Close()
+
+	dir := t.TempDir()
+	for _, elem := range ResumeTests {
+		path := filepath.Join(dir, elem.Name+".mp3")
+		if elem.Part != "" {
+			os.WriteFile(path+data.PartSuffix, []byte(elem.Part), 0666)
+		}
+		if elem.Info != "" {
+			os.WriteFile(path+data.PartInfoSuffix, []byte(elem.Info+"\n"), 0666)
+		}
+
+		resp, offset, err := data.RequestHTTP(srv.URL+"/"+elem.Name, path)
+		if elem.Status != 0 {
+			var serr *data.StatusError
+			if !errors.As(err, &serr) || serr.Code != elem.Status {
+				t.Errorf("%s: expected status %d, got %v", elem.Name, elem.Status, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: unexpected error: %s", elem.Name, err)
+			continue
+		}
+
+		body, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+
+		if offset != elem.Offset {
+			t.Errorf("%s: expected offset %d, got %d", elem.Name, elem.Offset, offset)
+		}
+		if ranged != elem.Range {
+			t.Errorf("%s: expected range request %t, got %t", elem.Name, elem.Range, ranged)
+		}
+		if !bytes.Equal(body, episodeBody[offset:]) {
+			t.Errorf("%s: expected body %q, got %q", elem.Name, episodeBody[offset:], body)
+		}
+
+		// The validator is stored for resuming later
+		if info, _ := os.ReadFile(path + data.PartInfoSuffix); strings.TrimSpace(string(info)) != `"v1"` {
+			t.Errorf("%s: expected validator %q stored, got %q", elem.Name, `"v1"`, info)
+		}
+	}
+}
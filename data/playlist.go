@@ -0,0 +1,334 @@
+package data
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// PlaylistDirname is the name of the directory within the data
+	// directory in which playlists are stored.
+	PlaylistDirname = "playlists"
+	// PlaylistComment is written at the top of each playlist file.
+	PlaylistComment = "# This is a podbit playlist file\n# Each line is the URL of an episode in the playlist"
+)
+
+// Playlist errors.
+var (
+	ErrorPlaylistName   = errors.New("invalid playlist name")
+	ErrorPlaylistExists = errors.New("playlist already exists")
+	ErrorPlaylistSmart  = errors.New("cannot edit the episodes of a smart playlist")
+)
+
+// Playlist is a named, ordered list of episodes saved to disk. Episodes are
+// stored by URL, so may refer to episodes which are no longer in the queue.
+//
+// A smart playlist has a query instead of a fixed list of episodes. The
+// episodes of a smart playlist are those which matched the query when the
+// queue was last reloaded.
+type Playlist struct {
+	Name  string
+	Query string
+	URLs  []string
+}
+
+// smart caches the results of evaluating each smart playlist, mapping the
+// query to the resulting URLs.
+var smart = struct {
+	mut     sync.RWMutex
+	results map[string][]string
+}{results: make(map[string][]string)}
+
+// saved caches the playlists read from disk, so that they are not read again
+// each time they are displayed. The cache is cleared whenever a playlist is
+// changed and when playlists are refreshed.
+var saved = struct {
+	mut   sync.RWMutex
+	names []string
+	lists map[string]Playlist
+}{lists: make(map[string]Playlist)}
+
+// forgetPlaylists clears the cache of playlists read from disk.
+func forgetPlaylists() {
+	saved.mut.Lock()
+	saved.names = nil
+	saved.lists = make(map[string]Playlist)
+	saved.mut.Unlock()
+}
+
+// copy returns a copy of the playlist which does not share its URLs.
+func (p Playlist) copy() Playlist {
+	p.URLs = append([]string(nil), p.URLs...)
+	return p
+}
+
+func playlistPath(name string) (string, error) {
+	if name == "" || strings.ContainsRune(name, os.PathSeparator) || strings.HasPrefix(name, ".") {
+		return "", ErrorPlaylistName
+	}
+
+	return filepath.Join(DataPath(PlaylistDirname), name), nil
+}
+
+// GetPlaylists returns the names of all saved playlists in alphabetical
+// order.
+func GetPlaylists() []string {
+	saved.mut.RLock()
+	names := saved.names
+	saved.mut.RUnlock()
+	if names != nil {
+		return append([]string(nil), names...)
+	}
+
+	entries, err := os.ReadDir(DataPath(PlaylistDirname))
+	if err != nil {
+		return nil
+	}
+
+	names = make([]string, 0, len(entries))
+	for _, ent := range entries {
+		if !ent.IsDir() && !strings.HasPrefix(ent.Name(), ".") {
+			names = append(names, ent.Name())
+		}
+	}
+	sort.Strings(names)
+
+	saved.mut.Lock()
+	saved.names = names
+	saved.mut.Unlock()
+
+	return append([]string(nil), names...)
+}
+
+// LoadPlaylist reads the named playlist from disk, or from the cache if it
+// has been read since playlists were last refreshed.
+func LoadPlaylist(name string) (Playlist, error) {
+	saved.mut.RLock()
+	pl, ok := saved.lists[name]
+	saved.mut.RUnlock()
+	if ok {
+		return pl.copy(), nil
+	}
+
+	pl = Playlist{Name: name}
+
+	path, err := playlistPath(name)
+	if err != nil {
+		return pl, err
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return pl, err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		elem := strings.TrimSpace(scanner.Text())
+		if len(elem) == 0 || strings.HasPrefix(elem, "#") {
+			continue
+		}
+
+		if strings.HasPrefix(elem, "query ") {
+			pl.Query = strings.TrimSpace(strings.TrimPrefix(elem, "query "))
+			continue
+		}
+
+		pl.URLs = append(pl.URLs, elem)
+	}
+
+	if err := scanner.Err(); err != nil {
+		return pl, err
+	}
+
+	if pl.Query != "" {
+		pl.URLs = smartResults(pl.Query)
+	}
+
+	saved.mut.Lock()
+	saved.lists[name] = pl.copy()
+	saved.mut.Unlock()
+
+	return pl, nil
+}
+
+// episodeInfo gathers the information a query can match for an item at
+// position i in the queue.
+func episodeInfo(i int, item *QueueItem) EpisodeInfo {
+	info := EpisodeInfo{
+		URL:     item.URL,
+		Podcast: DB.GetFriendlyName(item.URL),
+		State:   item.State,
+		Added:   i,
+	}
+
+	if ep, ok := Downloads.Query(item.Path); ok {
+		info.Title = ep.Title
+		info.Host = ep.Host
+		info.Year = ep.Date
+		info.Duration = ep.Duration
+	}
+
+	if stamp, res, err := Stamps.RawStat(item.Path); err == nil {
+		info.Listened = time.Unix(*stamp, 0)
+		info.Resume = time.Duration(*res) * time.Second
+	}
+
+	return info
+}
+
+// EvaluateQuery runs a query against every episode in the queue, returning
+// the URLs of the matching episodes.
+func EvaluateQuery(q *Query) []string {
+	var eps []EpisodeInfo
+	Q.Range(func(i int, item *QueueItem) bool {
+		eps = append(eps, episodeInfo(i, item))
+		return true
+	})
+
+	res := q.Apply(eps)
+	urls := make([]string, len(res))
+	for i, e := range res {
+		urls[i] = e.URL
+	}
+
+	return urls
+}
+
+// smartResults returns the cached results of a smart playlist query,
+// evaluating it if not yet cached. Invalid queries have no results.
+func smartResults(query string) []string {
+	smart.mut.RLock()
+	urls, ok := smart.results[query]
+	smart.mut.RUnlock()
+	if ok {
+		return urls
+	}
+
+	q, err := ParseQuery(query)
+	if err == nil {
+		urls = EvaluateQuery(q)
+	}
+
+	smart.mut.Lock()
+	smart.results[query] = urls
+	smart.mut.Unlock()
+
+	return urls
+}
+
+// RefreshPlaylists re-evaluates the queries of all smart playlists. This is
+// called automatically each time the queue is reloaded.
+func RefreshPlaylists() {
+	smart.mut.Lock()
+	smart.results = make(map[string][]string)
+	smart.mut.Unlock()
+	forgetPlaylists()
+
+	for _, name := range GetPlaylists() {
+		// Loading evaluates the query
+		LoadPlaylist(name)
+	}
+}
+
+// Save writes the playlist to disk, replacing any previous contents.
+func (p Playlist) Save() error {
+	path, err := playlistPath(p.Name)
+	if err != nil {
+		return err
+	}
+
+	err = os.MkdirAll(filepath.Dir(path), os.ModePerm)
+	if err != nil {
+		return err
+	}
+
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	defer forgetPlaylists()
+
+	fmt.Fprintln(f, PlaylistComment)
+	if p.Query != "" {
+		fmt.Fprintln(f, "query "+p.Query)
+		return nil
+	}
+
+	for _, url := range p.URLs {
+		fmt.Fprintln(f, url)
+	}
+
+	return nil
+}
+
+// Items returns the queue items for each episode in the playlist, skipping
+// those which are no longer in the queue.
+func (p Playlist) Items() []*QueueItem {
+	items := make([]*QueueItem, 0, len(p.URLs))
+	for _, url := range p.URLs {
+		if item := Q.GetEpisodeByURL(url); item != nil {
+			items = append(items, item)
+		}
+	}
+
+	return items
+}
+
+// AppendPlaylist adds episodes to the end of the named playlist, creating it
+// if it does not exist.
+func AppendPlaylist(name string, items []*QueueItem) error {
+	pl, err := LoadPlaylist(name)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	if pl.Query != "" {
+		return ErrorPlaylistSmart
+	}
+
+	for _, item := range items {
+		pl.URLs = append(pl.URLs, item.URL)
+	}
+
+	return pl.Save()
+}
+
+// RenamePlaylist renames a playlist on disk. Refuses to overwrite an existing
+// playlist.
+func RenamePlaylist(from, to string) error {
+	fpath, err := playlistPath(from)
+	if err != nil {
+		return err
+	}
+	tpath, err := playlistPath(to)
+	if err != nil {
+		return err
+	}
+
+	if _, err := os.Stat(tpath); err == nil {
+		return ErrorPlaylistExists
+	}
+
+	defer forgetPlaylists()
+	return os.Rename(fpath, tpath)
+}
+
+// DeletePlaylist removes a playlist from disk.
+func DeletePlaylist(name string) error {
+	path, err := playlistPath(name)
+	if err != nil {
+		return err
+	}
+
+	defer forgetPlaylists()
+	return os.Remove(path)
+}
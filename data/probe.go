@@ -0,0 +1,105 @@
+package data
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"os"
+	"time"
+)
+
+// MPEG audio layer III lookup tables, indexed by the fields of a frame header.
+var (
+	mp3Bitrates = [2][16]int64{
+		{0, 32, 40, 48, 56, 64, 80, 96, 112, 128, 160, 192, 224, 256, 320, 0}, // MPEG-1
+		{0, 8, 16, 24, 32, 40, 48, 56, 64, 80, 96, 112, 128, 144, 160, 0},     // MPEG-2/2.5
+	}
+	mp3SampleRates = [4][3]int64{
+		{11025, 12000, 8000},  // MPEG-2.5
+		{0, 0, 0},             // Reserved
+		{22050, 24000, 16000}, // MPEG-2
+		{44100, 48000, 32000}, // MPEG-1
+	}
+)
+
+// probeDuration estimates the duration of an MP3 file from its first frame,
+// using the frame count in a Xing/Info or VBRI header if present, or else by
+// assuming a constant bitrate. Returns zero if the duration could not be
+// determined, such as for files which are not MP3.
+func probeDuration(file *os.File) time.Duration {
+	stat, err := file.Stat()
+	if err != nil {
+		return 0
+	}
+
+	// Skip over any ID3v2 tag
+	var start int64
+	id3 := make([]byte, 10)
+	if _, err := file.ReadAt(id3, 0); err != nil {
+		return 0
+	}
+	if bytes.Equal(id3[:3], []byte("ID3")) {
+		start = 10 + (int64(id3[6])<<21 | int64(id3[7])<<14 | int64(id3[8])<<7 | int64(id3[9]))
+		if id3[5]&0x10 != 0 {
+			start += 10 // Footer present
+		}
+	}
+
+	buf := make([]byte, 4096)
+	n, err := file.ReadAt(buf, start)
+	if err != nil && err != io.EOF {
+		return 0
+	}
+	buf = buf[:n]
+
+	for i := 0; i+4 <= len(buf); i++ {
+		if buf[i] != 0xFF || buf[i+1]&0xE0 != 0xE0 {
+			continue
+		}
+
+		version := (buf[i+1] >> 3) & 0x03
+		layer := (buf[i+1] >> 1) & 0x03
+		brIndex := buf[i+2] >> 4
+		srIndex := (buf[i+2] >> 2) & 0x03
+		mono := buf[i+3]>>6 == 0x03
+
+		// Only layer III is supported
+		if version == 1 || layer != 1 || brIndex == 0 || brIndex == 15 || srIndex == 3 {
+			continue
+		}
+
+		mpeg1 := version == 3
+		table, samples, side := 1, int64(576), 17
+		if mono {
+			side = 9
+		}
+		if mpeg1 {
+			table, samples, side = 0, 1152, 32
+			if mono {
+				side = 17
+			}
+		}
+
+		bitrate := mp3Bitrates[table][brIndex] * 1000
+		rate := mp3SampleRates[version][srIndex]
+
+		// VBR files have a header with the frame count in the first frame
+		var frames int64
+		if x := i + 4 + side; x+12 <= len(buf) && (bytes.Equal(buf[x:x+4], []byte("Xing")) || bytes.Equal(buf[x:x+4], []byte("Info"))) {
+			if binary.BigEndian.Uint32(buf[x+4:x+8])&0x01 != 0 {
+				frames = int64(binary.BigEndian.Uint32(buf[x+8 : x+12]))
+			}
+		} else if v := i + 36; v+18 <= len(buf) && bytes.Equal(buf[v:v+4], []byte("VBRI")) {
+			frames = int64(binary.BigEndian.Uint32(buf[v+14 : v+18]))
+		}
+
+		if frames > 0 {
+			return time.Duration(float64(frames*samples) / float64(rate) * float64(time.Second))
+		}
+
+		size := stat.Size() - start - int64(i)
+		return time.Duration(float64(size*8) / float64(bitrate) * float64(time.Second))
+	}
+
+	return 0
+}
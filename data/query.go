@@ -0,0 +1,551 @@
+package data
+
+import (
+	"errors"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// ErrQuerySyntax is the base error for all query syntax errors.
+var ErrQuerySyntax = errors.New("Error: Syntax error in query")
+
+// QuerySyntaxError is a query syntax error which references the offending
+// word in the query.
+type QuerySyntaxError struct {
+	Word    string
+	Comment string
+}
+
+func (q QuerySyntaxError) Error() string {
+	if q.Word == "" {
+		return ErrQuerySyntax.Error() + ": " + q.Comment
+	}
+
+	return ErrQuerySyntax.Error() + ": at " + strconv.Quote(q.Word) + ": " + q.Comment
+}
+
+func (q QuerySyntaxError) Unwrap() error {
+	return ErrQuerySyntax
+}
+
+// EpisodeInfo is the information about an episode which a query is able to
+// match against. Unknown durations and times are left as zero.
+type EpisodeInfo struct {
+	URL     string
+	Podcast string
+	Title   string
+	Host    string
+	State   int
+	Year    int
+	// Added is the position of the episode in the queue file, so higher
+	// values were added more recently
+	Added int
+
+	Duration time.Duration
+	Resume   time.Duration
+	Listened time.Time
+}
+
+// Query field types.
+const (
+	fieldString = iota
+	fieldState
+	fieldNumber
+	fieldSpan
+)
+
+// queryFields maps each field name usable in a query to its type.
+var queryFields = map[string]int{
+	"url":      fieldString,
+	"podcast":  fieldString,
+	"title":    fieldString,
+	"host":     fieldString,
+	"state":    fieldState,
+	"year":     fieldNumber,
+	"added":    fieldNumber,
+	"duration": fieldSpan,
+	"resume":   fieldSpan,
+	"listened": fieldSpan,
+}
+
+// stateNames maps the names of states usable in queries to states.
+var stateNames = map[string]int{
+	"pending":    StatePending,
+	"downloaded": StateReady,
+	"played":     StatePlayed,
+	"finished":   StateFinished,
+}
+
+// matcher is a single node in a parsed query expression.
+type matcher interface {
+	match(e EpisodeInfo) bool
+}
+
+type andMatcher [2]matcher
+
+func (a andMatcher) match(e EpisodeInfo) bool {
+	return a[0].match(e) && a[1].match(e)
+}
+
+type orMatcher [2]matcher
+
+func (o orMatcher) match(e EpisodeInfo) bool {
+	return o[0].match(e) || o[1].match(e)
+}
+
+type notMatcher struct {
+	m matcher
+}
+
+func (n notMatcher) match(e EpisodeInfo) bool {
+	return !n.m.match(e)
+}
+
+// condition compares a field against one or more values. Span values are
+// stored as numbers of nanoseconds.
+type condition struct {
+	field string
+	op    string
+	strs  []string
+	nums  []int64
+}
+
+// value returns the value of the condition's field for an episode. For
+// numeric fields, ok is false if the value is unknown.
+func (c condition) value(e EpisodeInfo) (str string, num int64, ok bool) {
+	switch c.field {
+	case "url":
+		return e.URL, 0, true
+	case "podcast":
+		return e.Podcast, 0, true
+	case "title":
+		return e.Title, 0, true
+	case "host":
+		return e.Host, 0, true
+	case "state":
+		return "", int64(e.State), true
+	case "year":
+		return "", int64(e.Year), e.Year != 0
+	case "added":
+		return "", int64(e.Added), true
+	case "duration":
+		return "", int64(e.Duration), e.Duration != 0
+	case "resume":
+		return "", int64(e.Resume), true
+	case "listened":
+		if e.Listened.IsZero() {
+			return "", 0, false
+		}
+		return "", int64(time.Since(e.Listened)), true
+	}
+
+	return "", 0, false
+}
+
+func (c condition) match(e EpisodeInfo) bool {
+	str, num, ok := c.value(e)
+	if !ok {
+		return false
+	}
+
+	if queryFields[c.field] == fieldString {
+		str = strings.ToLower(str)
+		for _, want := range c.strs {
+			var m bool
+			switch c.op {
+			case "=", "in":
+				m = str == want
+			case "!=":
+				m = str != want
+			case "~":
+				m = strings.Contains(str, want)
+			case "!~":
+				m = !strings.Contains(str, want)
+			}
+
+			if m {
+				return true
+			}
+		}
+
+		return false
+	}
+
+	for _, want := range c.nums {
+		var m bool
+		switch c.op {
+		case "=", "in":
+			m = num == want
+		case "!=":
+			m = num != want
+		case "<":
+			m = num < want
+		case "<=":
+			m = num <= want
+		case ">":
+			m = num > want
+		case ">=":
+			m = num >= want
+		}
+
+		if m {
+			return true
+		}
+	}
+
+	return false
+}
+
+// A Query is a parsed smart playlist query, which selects and orders
+// episodes based on their state and metadata.
+//
+// A query is made up of an optional filter expression, followed by an
+// optional sort clause and an optional limit. For example:
+//
+//	state in pending,downloaded and podcast in "A","B" and duration < 40m sort added desc
+//	resume > 0 limit 10
+//
+// Conditions compare a field to a value using one of the operators =, !=, <,
+// <=, >, >=, ~ (contains) or !~ (does not contain), or to a comma separated
+// list of values using "in". Conditions may be combined using "and", "or",
+// "not" and parentheses. String comparisons ignore case.
+//
+// The available fields are url, podcast, title and host (strings), state
+// (pending, downloaded, played or finished), year and added (numbers, where
+// added is the position in the queue file), and duration, resume and
+// listened (spans of time such as 40m, 1h30m or 7d, where listened is the
+// time since the episode was last listened to). Conditions on unknown values
+// never match.
+type Query struct {
+	expr  matcher
+	sort  string
+	desc  bool
+	limit int
+}
+
+// queryParser is a recursive descent parser over the words of a query.
+type queryParser struct {
+	words []string
+	pos   int
+}
+
+// splitQuery splits a query into words, treating quoted strings, operators,
+// commas and parentheses as separate words.
+func splitQuery(s string) ([]string, error) {
+	var words []string
+
+	r := []rune(s)
+	for i := 0; i < len(r); {
+		c := r[i]
+		switch {
+		case unicode.IsSpace(c):
+			i++
+		case c == '"':
+			j := i + 1
+			for j < len(r) && r[j] != '"' {
+				j++
+			}
+			if j >= len(r) {
+				return nil, QuerySyntaxError{string(r[i:]), "unterminated string"}
+			}
+
+			words = append(words, string(r[i:j+1]))
+			i = j + 1
+		case c == '(' || c == ')' || c == ',' || c == '~':
+			words = append(words, string(c))
+			i++
+		case c == '<' || c == '>' || c == '=' || c == '!':
+			j := i + 1
+			if j < len(r) && (r[j] == '=' || (c == '!' && r[j] == '~')) {
+				j++
+			}
+
+			words = append(words, string(r[i:j]))
+			i = j
+		default:
+			j := i
+			for j < len(r) && !unicode.IsSpace(r[j]) && !strings.ContainsRune("\"(),~<>=!", r[j]) {
+				j++
+			}
+
+			words = append(words, string(r[i:j]))
+			i = j
+		}
+	}
+
+	return words, nil
+}
+
+func (p *queryParser) peek() string {
+	if p.pos >= len(p.words) {
+		return ""
+	}
+
+	return p.words[p.pos]
+}
+
+func (p *queryParser) next() string {
+	w := p.peek()
+	p.pos++
+	return w
+}
+
+func (p *queryParser) done() bool {
+	w := strings.ToLower(p.peek())
+	return p.pos >= len(p.words) || w == "sort" || w == "limit"
+}
+
+func (p *queryParser) parseOr() (matcher, error) {
+	m, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+
+	for strings.ToLower(p.peek()) == "or" {
+		p.next()
+		r, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+
+		m = orMatcher{m, r}
+	}
+
+	return m, nil
+}
+
+func (p *queryParser) parseAnd() (matcher, error) {
+	m, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+
+	for strings.ToLower(p.peek()) == "and" {
+		p.next()
+		r, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+
+		m = andMatcher{m, r}
+	}
+
+	return m, nil
+}
+
+func (p *queryParser) parseUnary() (matcher, error) {
+	switch strings.ToLower(p.peek()) {
+	case "not":
+		p.next()
+		m, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+
+		return notMatcher{m}, nil
+	case "(":
+		p.next()
+		m, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+
+		if p.next() != ")" {
+			return nil, QuerySyntaxError{"(", "unmatched parenthesis"}
+		}
+
+		return m, nil
+	}
+
+	return p.parseCondition()
+}
+
+// parseSpan parses a span of time as accepted by time.ParseDuration, with the
+// addition of a "d" suffix for days.
+func parseSpan(s string) (time.Duration, error) {
+	if strings.HasSuffix(s, "d") {
+		days, err := strconv.ParseFloat(strings.TrimSuffix(s, "d"), 64)
+		if err != nil {
+			return 0, err
+		}
+
+		return time.Duration(days * float64(24*time.Hour)), nil
+	}
+
+	return time.ParseDuration(s)
+}
+
+func (p *queryParser) parseValue(c *condition) error {
+	val := p.next()
+	if val == "" {
+		return QuerySyntaxError{c.field, "expected value"}
+	}
+	if strings.HasPrefix(val, "\"") {
+		val = strings.Trim(val, "\"")
+	}
+
+	switch queryFields[c.field] {
+	case fieldString:
+		c.strs = append(c.strs, strings.ToLower(val))
+	case fieldState:
+		st, ok := stateNames[strings.ToLower(val)]
+		if !ok {
+			return QuerySyntaxError{val, "unknown state"}
+		}
+		c.nums = append(c.nums, int64(st))
+	case fieldNumber:
+		n, err := strconv.ParseInt(val, 10, 64)
+		if err != nil {
+			return QuerySyntaxError{val, "expected number"}
+		}
+		c.nums = append(c.nums, n)
+	case fieldSpan:
+		d, err := parseSpan(val)
+		if err != nil {
+			return QuerySyntaxError{val, "expected span of time"}
+		}
+		c.nums = append(c.nums, int64(d))
+	}
+
+	return nil
+}
+
+func (p *queryParser) parseCondition() (matcher, error) {
+	field := strings.ToLower(p.next())
+	typ, ok := queryFields[field]
+	if !ok {
+		return nil, QuerySyntaxError{field, "unknown field"}
+	}
+
+	c := condition{field: field, op: strings.ToLower(p.next())}
+	switch c.op {
+	case "=", "!=", "in":
+	case "~", "!~":
+		if typ != fieldString {
+			return nil, QuerySyntaxError{c.op, "operator only valid for strings"}
+		}
+	case "<", "<=", ">", ">=":
+		if typ == fieldString || typ == fieldState {
+			return nil, QuerySyntaxError{c.op, "operator not valid for " + field}
+		}
+	default:
+		return nil, QuerySyntaxError{c.op, "expected operator"}
+	}
+
+	if err := p.parseValue(&c); err != nil {
+		return nil, err
+	}
+	for c.op == "in" && p.peek() == "," {
+		p.next()
+		if err := p.parseValue(&c); err != nil {
+			return nil, err
+		}
+	}
+
+	return c, nil
+}
+
+// ParseQuery parses a smart playlist query. See the documentation of Query
+// for the syntax.
+func ParseQuery(s string) (*Query, error) {
+	words, err := splitQuery(s)
+	if err != nil {
+		return nil, err
+	}
+
+	q := new(Query)
+	p := queryParser{words: words}
+
+	if !p.done() {
+		q.expr, err = p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if strings.ToLower(p.peek()) == "sort" {
+		p.next()
+		q.sort = strings.ToLower(p.next())
+		if _, ok := queryFields[q.sort]; !ok {
+			return nil, QuerySyntaxError{q.sort, "unknown sort field"}
+		}
+
+		switch strings.ToLower(p.peek()) {
+		case "desc":
+			q.desc = true
+			p.next()
+		case "asc":
+			p.next()
+		}
+	}
+
+	if strings.ToLower(p.peek()) == "limit" {
+		p.next()
+		w := p.next()
+		q.limit, err = strconv.Atoi(w)
+		if err != nil || q.limit <= 0 {
+			return nil, QuerySyntaxError{w, "expected positive limit"}
+		}
+	}
+
+	if p.pos < len(p.words) {
+		return nil, QuerySyntaxError{p.peek(), "unexpected word"}
+	}
+
+	return q, nil
+}
+
+// Match returns true if an episode matches the query's filter expression.
+// A query without a filter expression matches every episode.
+func (q *Query) Match(e EpisodeInfo) bool {
+	return q.expr == nil || q.expr.match(e)
+}
+
+// Apply filters, sorts and limits a list of episodes according to the
+// query. The order of the input is preserved where not otherwise sorted.
+func (q *Query) Apply(eps []EpisodeInfo) []EpisodeInfo {
+	res := make([]EpisodeInfo, 0, len(eps))
+	for _, e := range eps {
+		if q.Match(e) {
+			res = append(res, e)
+		}
+	}
+
+	if q.sort != "" {
+		c := condition{field: q.sort}
+		sort.SliceStable(res, func(i, j int) bool {
+			si, ni, oki := c.value(res[i])
+			sj, nj, okj := c.value(res[j])
+
+			// Unknown values always sort last
+			if oki != okj {
+				return oki
+			}
+
+			var less bool
+			if queryFields[q.sort] == fieldString {
+				si, sj = strings.ToLower(si), strings.ToLower(sj)
+				less = si < sj
+				if q.desc {
+					less = si > sj
+				}
+			} else {
+				less = ni < nj
+				if q.desc {
+					less = ni > nj
+				}
+			}
+
+			return less
+		})
+	}
+
+	if q.limit > 0 && len(res) > q.limit {
+		res = res[:q.limit]
+	}
+
+	return res
+}
@@ -0,0 +1,93 @@
+package data_test
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/ejv2/podbit/data"
+)
+
+var QueryEpisodes = []data.EpisodeInfo{
+	{URL: "a1", Podcast: "Alpha", Title: "First Alpha", State: data.StatePending, Added: 0, Duration: 30 * time.Minute},
+	{URL: "a2", Podcast: "Alpha", Title: "Second Alpha", State: data.StatePlayed, Added: 1, Duration: 50 * time.Minute, Resume: 10 * time.Minute},
+	{URL: "b1", Podcast: "Beta Cast", Title: "First Beta", State: data.StateReady, Added: 2, Duration: 20 * time.Minute},
+	{URL: "c1", Podcast: "Gamma", Title: "First Gamma", State: data.StateFinished, Added: 3},
+	{URL: "b2", Podcast: "Beta Cast", Title: "Second Beta", State: data.StatePending, Added: 4},
+}
+
+var QueryTests = []struct {
+	Query   string
+	Expects []string
+}{
+	{"", []string{"a1", "a2", "b1", "c1", "b2"}},
+	{"state = pending", []string{"a1", "b2"}},
+	{"state in pending,downloaded", []string{"a1", "b1", "b2"}},
+	{"podcast in alpha,\"Beta Cast\"", []string{"a1", "a2", "b1", "b2"}},
+	{"title ~ second", []string{"a2", "b2"}},
+	{"title !~ first", []string{"a2", "b2"}},
+	{"resume > 0", []string{"a2"}},
+	{"duration < 40m", []string{"a1", "b1"}},
+	{"not duration < 40m", []string{"a2", "c1", "b2"}},
+	{"podcast = alpha or podcast = gamma", []string{"a1", "a2", "c1"}},
+	{"state = pending and (podcast = alpha or podcast = gamma)", []string{"a1"}},
+	{"state in pending,downloaded and duration < 40m sort added desc", []string{"b1", "a1"}},
+	{"sort duration desc", []string{"a2", "a1", "b1", "c1", "b2"}},
+	{"sort title limit 2", []string{"a1", "b1"}},
+}
+
+var QueryErrors = []string{
+	"nonsense = 1",
+	"state = sleeping",
+	"state < pending",
+	"title > b",
+	"duration < forever",
+	"year = two",
+	"(state = pending",
+	"title = \"unterminated",
+	"state = pending extra",
+	"state",
+	"sort nonsense",
+	"limit 0",
+}
+
+// TestQuery tests parsing and applying of valid queries.
+func TestQuery(t *testing.T) {
+	for _, elem := range QueryTests {
+		q, err := data.ParseQuery(elem.Query)
+		if err != nil {
+			t.Errorf("query %q: unexpected error: %s", elem.Query, err)
+			continue
+		}
+
+		res := q.Apply(QueryEpisodes)
+		urls := make([]string, len(res))
+		for i, e := range res {
+			urls[i] = e.URL
+		}
+
+		if len(urls) != len(elem.Expects) {
+			t.Errorf("query %q: expected %v, got %v", elem.Query, elem.Expects, urls)
+			continue
+		}
+		for i := range urls {
+			if urls[i] != elem.Expects[i] {
+				t.Errorf("query %q: expected %v, got %v", elem.Query, elem.Expects, urls)
+				break
+			}
+		}
+	}
+}
+
+// TestQueryErrors tests that invalid queries are rejected with a syntax
+// error.
+func TestQueryErrors(t *testing.T) {
+	for _, elem := range QueryErrors {
+		_, err := data.ParseQuery(elem)
+		if err == nil {
+			t.Errorf("query %q: expected error", elem)
+		} else if !errors.Is(err, data.ErrQuerySyntax) {
+			t.Errorf("query %q: expected syntax error, got %s", elem, err)
+		}
+	}
+}
@@ -353,6 +353,21 @@ func (q *Queue) GetEpisodeByURL(url string) *QueueItem {
 	return q.Linkmap[url]
 }
 
+// GetEpisodeByPath searches the queue file for an entry which is stored at
+// the requested path in the cache.
+func (q *Queue) GetEpisodeByPath(path string) (found *QueueItem) {
+	q.Range(func(_ int, elem *QueueItem) bool {
+		if elem.Path == path {
+			found = elem
+			return false
+		}
+
+		return true
+	})
+
+	return
+}
+
 // GetEpisodeByTitle searches the queue file for an entry
 // with the requested title from cache.
 func (q *Queue) GetEpisodeByTitle(title string) (found *QueueItem) {
@@ -0,0 +1,127 @@
+package data
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+// Retry policy for failed HTTP downloads.
+var (
+	// MaxAttempts is the number of times a download is attempted before it
+	// is marked as failed. One disables retrying.
+	MaxAttempts = 5
+	// RetryBase is the delay before the first retry, which is doubled for
+	// each attempt after.
+	RetryBase = 5 * time.Second
+	// RetryMax is the longest delay between two attempts.
+	RetryMax = 5 * time.Minute
+)
+
+// ErrorConnectionLost is returned when the connection to the server is lost
+// part way through a download.
+var ErrorConnectionLost = errors.New("connection lost")
+
+// StatusError is returned when the server responds to a download request
+// with an unexpected status.
+type StatusError struct {
+	// Code is the HTTP status code of the response
+	Code int
+	// Status is the HTTP status line of the response
+	Status string
+	// RetryAfter is the delay requested by the server before trying again,
+	// or zero if none was given
+	RetryAfter time.Duration
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("%s: %s", ErrorDownloadStatus, e.Status)
+}
+
+func (e *StatusError) Unwrap() error {
+	return ErrorDownloadStatus
+}
+
+// retryAfter parses a Retry-After header, which is either a number of seconds
+// or a date.
+func retryAfter(h http.Header) time.Duration {
+	val := h.Get("Retry-After")
+	if val == "" {
+		return 0
+	}
+
+	if secs, err := strconv.Atoi(val); err == nil && secs > 0 {
+		return time.Duration(secs) * time.Second
+	}
+	if t, err := http.ParseTime(val); err == nil {
+		if d := time.Until(t); d > 0 {
+			return d
+		}
+	}
+
+	return 0
+}
+
+// transient returns true if err is likely to go away if the download is
+// tried again: network errors, server errors and rate limiting.
+func transient(err error) bool {
+	var serr *StatusError
+	if errors.As(err, &serr) {
+		return serr.Code >= 500 || serr.Code == http.StatusTooManyRequests
+	}
+
+	if errors.Is(err, ErrorConnectionLost) {
+		return true
+	}
+
+	// Every client error is a net.Error, so look at the cause instead
+	var uerr *url.Error
+	if errors.As(err, &uerr) {
+		err = uerr.Err
+	}
+
+	var nerr net.Error
+	return errors.As(err, &nerr) || errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF)
+}
+
+// backoff returns the delay before the given retry attempt, doubling from
+// RetryBase with random jitter, or the delay requested by the server if
+// longer.
+func backoff(attempt int, err error) time.Duration {
+	wait := RetryBase
+	for i := 1; i < attempt && wait < RetryMax; i++ {
+		wait *= 2
+	}
+	if wait > RetryMax {
+		wait = RetryMax
+	}
+
+	// Between half and all of the delay, so that failed downloads do not
+	// all retry at once
+	wait = wait/2 + time.Duration(rand.Int63n(int64(wait/2)+1))
+
+	var serr *StatusError
+	if errors.As(err, &serr) && serr.RetryAfter > wait {
+		wait = serr.RetryAfter
+	}
+
+	return wait
+}
+
+// retryLater arranges for the download to be attempted again after a delay
+// if err is transient and attempts remain. Returns false if the download
+// should fail instead. The download must be locked by the caller.
+func (d *Download) retryLater(err error) bool {
+	if !transient(err) || d.Attempts >= MaxAttempts {
+		return false
+	}
+
+	d.NextRetry = time.Now().Add(backoff(d.Attempts, err))
+	return true
+}
@@ -0,0 +1,102 @@
+package data_test
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/ejv2/podbit/data"
+)
+
+var RetryAfterTests = []struct {
+	Header string
+	Min    time.Duration
+	Max    time.Duration
+}{
+	{"", 0, 0},
+	{"120", 120 * time.Second, 120 * time.Second},
+	{"0", 0, 0},
+	{"-5", 0, 0},
+	{"soon", 0, 0},
+	{time.Now().Add(time.Hour).UTC().Format(http.TimeFormat), 59 * time.Minute, time.Hour},
+	{time.Now().Add(-time.Hour).UTC().Format(http.TimeFormat), 0, 0},
+}
+
+var BackoffTests = []struct {
+	Attempt int
+	Err     error
+	Min     time.Duration
+	Max     time.Duration
+}{
+	{1, data.ErrorConnectionLost, 5 * time.Second, 10 * time.Second},
+	{2, data.ErrorConnectionLost, 10 * time.Second, 20 * time.Second},
+	{3, data.ErrorConnectionLost, 20 * time.Second, 40 * time.Second},
+	{10, data.ErrorConnectionLost, 30 * time.Second, 60 * time.Second},
+	{1, &data.StatusError{Code: 503, RetryAfter: 45 * time.Second}, 45 * time.Second, 45 * time.Second},
+	{4, &data.StatusError{Code: 503, RetryAfter: time.Second}, 30 * time.Second, 60 * time.Second},
+}
+
+var TransientTests = []struct {
+	Err       error
+	Transient bool
+}{
+	{&data.StatusError{Code: 500}, true},
+	{&data.StatusError{Code: 503}, true},
+	{&data.StatusError{Code: 429}, true},
+	{&data.StatusError{Code: 404}, false},
+	{&data.StatusError{Code: 403}, false},
+	{fmt.Errorf("reading: %w", data.ErrorConnectionLost), true},
+	{io.ErrUnexpectedEOF, true},
+	{&url.Error{Op: "Get", URL: "http://example.com", Err: &net.OpError{Op: "dial", Err: errors.New("refused")}}, true},
+	{&url.Error{Op: "Get", URL: "http://example.com", Err: errors.New("unsupported protocol scheme")}, false},
+	{data.ErrorNotAudio, false},
+}
+
+// TestRetryAfter tests parsing of the Retry-After header in both of its
+// forms.
+func TestRetryAfter(t *testing.T) {
+	for _, elem := range RetryAfterTests {
+		h := http.Header{}
+		if elem.Header != "" {
+			h.Set("Retry-After", elem.Header)
+		}
+
+		if d := data.RetryAfter(h); d < elem.Min || d > elem.Max {
+			t.Errorf("retry after %q: expected between %s and %s, got %s", elem.Header, elem.Min, elem.Max, d)
+		}
+	}
+}
+
+// TestBackoff tests that the delay between attempts doubles up to the
+// maximum, and respects the delay requested by the server.
+func TestBackoff(t *testing.T) {
+	base, max := data.RetryBase, data.RetryMax
+	defer func() {
+		data.RetryBase, data.RetryMax = base, max
+	}()
+	data.RetryBase, data.RetryMax = 10*time.Second, time.Minute
+
+	for _, elem := range BackoffTests {
+		// Jitter is random, so try a few times
+		for i := 0; i < 20; i++ {
+			if d := data.Backoff(elem.Attempt, elem.Err); d < elem.Min || d > elem.Max {
+				t.Errorf("attempt %d (%v): expected between %s and %s, got %s", elem.Attempt, elem.Err, elem.Min, elem.Max, d)
+				break
+			}
+		}
+	}
+}
+
+// TestTransient tests which errors cause a download to be retried.
+func TestTransient(t *testing.T) {
+	for _, elem := range TransientTests {
+		if tr := data.Transient(elem.Err); tr != elem.Transient {
+			t.Errorf("error %v: expected transient %t, got %t", elem.Err, elem.Transient, tr)
+		}
+	}
+}
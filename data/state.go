@@ -0,0 +1,105 @@
+package data
+
+import (
+	"errors"
+	"os"
+)
+
+// ErrorEpisodeBusy is returned when deleting an episode which is downloading.
+var ErrorEpisodeBusy = errors.New("episode is downloading")
+
+// MarkState manually sets the state of item. Marking an episode as pending
+// or ready marks it as unplayed, which is ready if it is downloaded or
+// pending otherwise. Marking an episode as played or finished counts as a
+// listen for the purposes of cache cleanup.
+//
+// The queue file should be saved once all changes are made.
+func MarkState(item *QueueItem, state int) {
+	item.Lock()
+	defer item.Unlock()
+
+	switch state {
+	case StatePending, StateReady:
+		if _, ok := Downloads.Query(item.Path); ok {
+			item.State = StateReady
+		} else {
+			item.State = StatePending
+		}
+	case StatePlayed, StateFinished:
+		item.State = state
+
+		// Keep any resume position
+		_, res, err := Stamps.Stat(item.Path)
+		Stamps.Touch(item.Path)
+		if err == nil {
+			Stamps.SetResume(item.Path, *res)
+		}
+	}
+}
+
+// ResetResume sets the resume position of item back to the start.
+func ResetResume(item *QueueItem) error {
+	item.RLock()
+	defer item.RUnlock()
+
+	return Stamps.SetResume(item.Path, 0)
+}
+
+// DeleteEpisode deletes the downloaded file of item and sets it back to
+// pending, so that it must be downloaded again before it can be played.
+func DeleteEpisode(item *QueueItem) error {
+	item.Lock()
+	defer item.Unlock()
+
+	if y, _ := Downloads.IsDownloading(item.Path); y {
+		return ErrorEpisodeBusy
+	}
+
+	if err := os.Remove(item.Path); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	os.Remove(item.Path + PartSuffix)
+	os.Remove(item.Path + PartInfoSuffix)
+	os.Remove(item.Path + MetaSuffix)
+
+	item.State = StatePending
+	Stamps.Prune(item.Path)
+	Downloads.episodes.Delete(item.Path)
+
+	return nil
+}
+
+// Progress returns how far through item has been listened to, from zero to
+// one. Finished episodes are always complete. If the length of the episode is
+// not known, zero is returned.
+func Progress(item *QueueItem) float64 {
+	item.RLock()
+	state, path := item.State, item.Path
+	item.RUnlock()
+
+	if state == StateFinished {
+		return 1
+	}
+
+	_, res, err := Stamps.Stat(path)
+	if err != nil || *res == 0 {
+		return 0
+	}
+
+	length, _ := Stamps.Length(path)
+	if length == 0 {
+		if ep, ok := Downloads.Query(path); ok {
+			length = uint64(ep.Duration.Seconds())
+		}
+	}
+	if length == 0 {
+		return 0
+	}
+
+	prog := float64(*res) / float64(length)
+	if prog > 1 {
+		prog = 1
+	}
+
+	return prog
+}
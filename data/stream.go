@@ -0,0 +1,95 @@
+package data
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"sync"
+)
+
+// Headers of the episode response passed on to the player.
+var streamHeaders = []string{
+	"Content-Type",
+	"Content-Length",
+	"Content-Range",
+	"Accept-Ranges",
+	"Last-Modified",
+	"ETag",
+}
+
+// The stream server is started on first use and lives until exit.
+var (
+	streamOnce  sync.Once
+	streamBase  string
+	streamError error
+)
+
+// StreamURL returns a URL on the loopback interface from which the player can
+// stream the episode at u. Requests to it are made by the download client, so
+// carry the headers and credentials of the podcast without exposing them to
+// the player, and are subject to the same redirect handling as downloads.
+func StreamURL(u string) (string, error) {
+	streamOnce.Do(startStream)
+	if streamError != nil {
+		return "", streamError
+	}
+
+	return streamBase + "?url=" + url.QueryEscape(u), nil
+}
+
+// startStream starts the stream server. The path includes a random token, so
+// that other local users cannot make requests with the podcast's credentials.
+func startStream() {
+	token := make([]byte, 16)
+	if _, err := rand.Read(token); err != nil {
+		streamError = err
+		return
+	}
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		streamError = err
+		return
+	}
+
+	path := "/" + hex.EncodeToString(token)
+	streamBase = "http://" + ln.Addr().String() + path
+
+	mux := http.NewServeMux()
+	mux.HandleFunc(path, serveStream)
+	go http.Serve(ln, mux)
+}
+
+// serveStream fetches the episode given by the url query parameter and copies
+// the response to the player, passing on any requested range so that the
+// player can seek.
+func serveStream(w http.ResponseWriter, r *http.Request) {
+	req, err := newRequest(r.URL.Query().Get("url"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	req = req.WithContext(r.Context())
+	if rng := r.Header.Get("Range"); rng != "" {
+		req.Header.Set("Range", rng)
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+	defer resp.Body.Close()
+
+	for _, key := range streamHeaders {
+		if val := resp.Header.Get(key); val != "" {
+			w.Header().Set(key, val)
+		}
+	}
+	w.WriteHeader(resp.StatusCode)
+
+	io.Copy(w, resp.Body)
+}
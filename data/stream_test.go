@@ -0,0 +1,68 @@
+package data_test
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/ejv2/podbit/data"
+)
+
+var StreamTests = []struct {
+	Name   string
+	Range  string
+	Status int
+	Body   string
+}{
+	{"whole", "", http.StatusOK, string(episodeBody)},
+	{"range", "bytes=4-7", http.StatusPartialContent, "this"},
+	{"missing", "", http.StatusNotFound, ""},
+}
+
+// TestStreamURL tests that episodes are passed through the stream server,
+// including range requests used for seeking.
+func TestStreamURL(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/missing.mp3" {
+			http.NotFound(w, r)
+			return
+		}
+
+		http.ServeContent(w, r, "episode.mp3", time.Time{}, bytes.NewReader(episodeBody))
+	}))
+	defer srv.Close()
+
+	for _, elem := range StreamTests {
+		path := "/episode.mp3"
+		if elem.Status == http.StatusNotFound {
+			path = "/missing.mp3"
+		}
+
+		u, err := data.StreamURL(srv.URL + path)
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %s", elem.Name, err)
+		}
+
+		req, _ := http.NewRequest(http.MethodGet, u, nil)
+		if elem.Range != "" {
+			req.Header.Set("Range", elem.Range)
+		}
+
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %s", elem.Name, err)
+		}
+		body, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+
+		if resp.StatusCode != elem.Status {
+			t.Errorf("%s: expected status %d, got %d", elem.Name, elem.Status, resp.StatusCode)
+		}
+		if elem.Status != http.StatusNotFound && string(body) != elem.Body {
+			t.Errorf("%s: expected body %q, got %q", elem.Name, elem.Body, string(body))
+		}
+	}
+}
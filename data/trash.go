@@ -0,0 +1,193 @@
+package data
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+const (
+	// TrashDirname is the name of the directory within the data directory
+	// into which episodes removed by the last cache cleanup are moved.
+	TrashDirname = "trash"
+	// TrashIndex is the name of the file within the trash directory which
+	// records where each trashed episode came from.
+	TrashIndex = ".index"
+)
+
+// ErrorTrashMissing is returned when restoring an episode which is no longer
+// in the trash.
+var ErrorTrashMissing = errors.New("episode no longer in trash")
+
+// Trashed is an episode which was removed from the cache and moved into the
+// trash, from where it may be restored.
+type Trashed struct {
+	// Path is the original path of the episode
+	Path string
+	// State is the state of the episode before it was removed
+	State int
+
+	// name is the name of the file in the trash directory
+	name string
+}
+
+// emptyTrash removes everything from the trash, ready for a new cleanup.
+func emptyTrash() {
+	os.RemoveAll(DataPath(TrashDirname))
+}
+
+// moveFile moves a file, copying it if the destination is on a different
+// filesystem, between which files cannot be renamed.
+func moveFile(from, to string) error {
+	err := os.Rename(from, to)
+	if !errors.Is(err, syscall.EXDEV) {
+		return err
+	}
+
+	src, err := os.Open(from)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	info, err := src.Stat()
+	if err != nil {
+		return err
+	}
+
+	dst, err := os.OpenFile(to, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, info.Mode().Perm())
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(dst, src); err != nil {
+		dst.Close()
+		os.Remove(to)
+		return err
+	}
+	if err := dst.Close(); err != nil {
+		os.Remove(to)
+		return err
+	}
+
+	return os.Remove(from)
+}
+
+// trashEpisode moves the file of item to the trash, returning the record of
+// where it came from. The item should be locked by the caller.
+func trashEpisode(item *QueueItem, index int) (Trashed, error) {
+	t := Trashed{
+		Path:  item.Path,
+		State: item.State,
+		name:  fmt.Sprintf("%d-%s", index, filepath.Base(item.Path)),
+	}
+
+	dir := DataPath(TrashDirname)
+	if err := os.MkdirAll(dir, os.ModeDir|os.ModePerm); err != nil {
+		return t, err
+	}
+
+	return t, moveFile(item.Path, filepath.Join(dir, t.name))
+}
+
+// writeTrash records the contents of the trash so that they may be restored
+// after podbit is restarted.
+func writeTrash(trashed []Trashed) error {
+	f, err := os.Create(filepath.Join(DataPath(TrashDirname), TrashIndex))
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	for _, t := range trashed {
+		fmt.Fprintf(f, "%d %s %s\n", t.State, t.name, t.Path)
+	}
+
+	return nil
+}
+
+// GetTrash returns the episodes which were moved to the trash by the last
+// cache cleanup and remain there.
+func GetTrash() []Trashed {
+	f, err := os.Open(filepath.Join(DataPath(TrashDirname), TrashIndex))
+	if err != nil {
+		return nil
+	}
+	defer f.Close()
+
+	var trashed []Trashed
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.SplitN(scanner.Text(), " ", 3)
+		if len(fields) != 3 {
+			continue
+		}
+
+		state, err := strconv.Atoi(fields[0])
+		if err != nil {
+			continue
+		}
+
+		t := Trashed{Path: fields[2], State: state, name: fields[1]}
+		if _, err := os.Stat(filepath.Join(DataPath(TrashDirname), t.name)); err == nil {
+			trashed = append(trashed, t)
+		}
+	}
+
+	return trashed
+}
+
+// Restore moves a trashed episode back into the cache, restoring its
+// previous state. The listen time of the episode is reset, so that it will
+// not be removed again by the next cleanup.
+func (t Trashed) Restore() error {
+	item := Q.GetEpisodeByPath(t.Path)
+	if item == nil {
+		return ErrorTrashMissing
+	}
+
+	err := moveFile(filepath.Join(DataPath(TrashDirname), t.name), t.Path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return ErrorTrashMissing
+		}
+		return err
+	}
+
+	item.Lock()
+	item.State = t.State
+	item.Unlock()
+
+	Stamps.Touch(t.Path)
+	Downloads.loadFile(t.Path, false)
+
+	return nil
+}
+
+// Trash moves a restored episode back into the trash, as it was before it
+// was restored.
+func (t Trashed) Trash() error {
+	item := Q.GetEpisodeByPath(t.Path)
+	if item == nil {
+		return ErrorTrashMissing
+	}
+
+	err := moveFile(t.Path, filepath.Join(DataPath(TrashDirname), t.name))
+	if err != nil {
+		return err
+	}
+
+	item.Lock()
+	item.State = StatePending
+	item.Unlock()
+
+	Stamps.Prune(t.Path)
+	Downloads.episodes.Delete(t.Path)
+
+	return nil
+}
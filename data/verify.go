@@ -0,0 +1,92 @@
+package data
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"mime"
+	"os"
+	"strings"
+)
+
+// Download verification errors.
+var (
+	ErrorNotAudio = errors.New("not an audio file")
+)
+
+// audioTypes are the content types accepted for episode downloads, other
+// than those in the audio and video families. Many servers send generic
+// binary types for media.
+var audioTypes = []string{
+	"application/octet-stream",
+	"application/ogg",
+	"binary/octet-stream",
+}
+
+// audioMagic are the signatures found at the start of accepted media files,
+// along with the offset at which they appear.
+var audioMagic = []struct {
+	offset int
+	magic  []byte
+}{
+	{0, []byte("ID3")},                  // MP3 with ID3v2 tag
+	{0, []byte("OggS")},                 // Ogg Vorbis/Opus
+	{0, []byte("fLaC")},                 // FLAC
+	{0, []byte("RIFF")},                 // WAV
+	{0, []byte{0x1A, 0x45, 0xDF, 0xA3}}, // Matroska/WebM
+	{4, []byte("ftyp")},                 // MP4/M4A
+}
+
+// checkContentType returns an error if the content type sent with a download
+// is not for audio or video. An empty content type is accepted.
+func checkContentType(header string) error {
+	if header == "" {
+		return nil
+	}
+
+	ct, _, err := mime.ParseMediaType(header)
+	if err != nil {
+		return nil
+	}
+
+	if strings.HasPrefix(ct, "audio/") || strings.HasPrefix(ct, "video/") {
+		return nil
+	}
+	for _, t := range audioTypes {
+		if ct == t {
+			return nil
+		}
+	}
+
+	return fmt.Errorf("%w (content type %s)", ErrorNotAudio, ct)
+}
+
+// checkMagic returns an error if the file at path does not start with the
+// signature of a known audio or video format.
+func checkMagic(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	head := make([]byte, 16)
+	n, _ := f.Read(head)
+	head = head[:n]
+
+	for _, m := range audioMagic {
+		if len(head) >= m.offset+len(m.magic) && bytes.Equal(head[m.offset:m.offset+len(m.magic)], m.magic) {
+			return nil
+		}
+	}
+
+	// Raw MPEG audio frame sync
+	if len(head) >= 2 && head[0] == 0xFF && head[1]&0xE0 == 0xE0 {
+		return nil
+	}
+
+	if len(head) == 0 {
+		return fmt.Errorf("%w (empty file)", ErrorNotAudio)
+	}
+	return ErrorNotAudio
+}
@@ -0,0 +1,78 @@
+package data_test
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/ejv2/podbit/data"
+)
+
+var ContentTypeTests = []struct {
+	Header string
+	Audio  bool
+}{
+	{"", true},
+	{"audio/mpeg", true},
+	{"audio/mp4; codecs=mp4a.40.2", true},
+	{"video/mp4", true},
+	{"application/octet-stream", true},
+	{"application/ogg", true},
+	{"text/html; charset=utf-8", false},
+	{"application/json", false},
+	{"application/x-mpegurl", false},
+	{"application/vnd.apple.mpegurl", false},
+}
+
+var MagicTests = []struct {
+	Name  string
+	Data  []byte
+	Audio bool
+}{
+	{"id3", []byte("ID3\x04\x00\x00\x00\x00\x00\x00"), true},
+	{"ogg", []byte("OggS\x00\x02"), true},
+	{"flac", []byte("fLaC\x00\x00\x00\x22"), true},
+	{"wav", []byte("RIFF\x24\x08\x00\x00WAVE"), true},
+	{"webm", []byte{0x1A, 0x45, 0xDF, 0xA3, 0x01}, true},
+	{"m4a", []byte("\x00\x00\x00\x20ftypM4A "), true},
+	{"mpeg frame", []byte{0xFF, 0xFB, 0x90, 0x64}, true},
+	{"html", []byte("<!DOCTYPE html><html>"), false},
+	{"playlist", []byte("#EXTM3U\n#EXT-X-VERSION:3\n"), false},
+	{"empty", nil, false},
+}
+
+// TestContentType tests that only audio content types are accepted for
+// downloads.
+func TestContentType(t *testing.T) {
+	for _, elem := range ContentTypeTests {
+		err := data.CheckContentType(elem.Header)
+		if elem.Audio && err != nil {
+			t.Errorf("content type %q: unexpected error: %s", elem.Header, err)
+		}
+		if !elem.Audio && !errors.Is(err, data.ErrorNotAudio) {
+			t.Errorf("content type %q: expected not audio, got %v", elem.Header, err)
+		}
+	}
+}
+
+// TestMagic tests that downloaded files are recognised as audio by their
+// signatures.
+func TestMagic(t *testing.T) {
+	dir := t.TempDir()
+
+	for _, elem := range MagicTests {
+		path := filepath.Join(dir, elem.Name)
+		if err := os.WriteFile(path, elem.Data, 0666); err != nil {
+			t.Fatal(err)
+		}
+
+		err := data.CheckMagic(path)
+		if elem.Audio && err != nil {
+			t.Errorf("%s: unexpected error: %s", elem.Name, err)
+		}
+		if !elem.Audio && !errors.Is(err, data.ErrorNotAudio) {
+			t.Errorf("%s: expected not audio, got %v", elem.Name, err)
+		}
+	}
+}
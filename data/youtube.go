@@ -0,0 +1,402 @@
+package data
+
+import (
+	"bufio"
+	"encoding/json"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	ev "github.com/ejv2/podbit/event"
+)
+
+// YouTube downloading constants.
+const (
+	YoutubeDL    string = "youtube-dl"
+	YoutubeDLP   string = "yt-dlp"
+	YoutubeFlags string = "--add-metadata --newline --no-colors --extract-audio --write-info-json"
+
+	// youtubeProgress is the progress template given to yt-dlp, which
+	// prints machine readable progress lines.
+	youtubeProgress = "download:" + progressPrefix + " %(progress.downloaded_bytes)s %(progress.total_bytes)s %(progress.total_bytes_estimate)s %(progress.speed)s"
+	progressPrefix  = "[podbit]"
+)
+
+// MetaSuffix is appended to the path of an episode to give the path of the
+// file storing metadata reported by the YouTube downloader.
+const MetaSuffix = ".meta"
+
+// YouTube downloader configuration.
+var (
+	// YoutubeFormat selects the format downloaded by the downloader.
+	YoutubeFormat = "bestaudio"
+	// YoutubeAudio is the audio format to which downloads are converted.
+	YoutubeAudio = "mp3"
+	// YoutubeArgs are extra arguments passed to the downloader.
+	YoutubeArgs []string
+)
+
+// youtubeMeta is the subset of the info JSON written by YouTube downloaders
+// which is stored as episode metadata.
+type youtubeMeta struct {
+	Title      string  `json:"title"`
+	Uploader   string  `json:"uploader"`
+	UploadDate string  `json:"upload_date"`
+	Duration   float64 `json:"duration"`
+	Thumbnail  string  `json:"thumbnail"`
+}
+
+// readMeta reads the metadata stored alongside the episode at path, if any.
+func readMeta(path string) (meta youtubeMeta, ok bool) {
+	buf, err := os.ReadFile(path + MetaSuffix)
+	if err != nil {
+		return meta, false
+	}
+
+	return meta, json.Unmarshal(buf, &meta) == nil
+}
+
+// apply fills in the details of ep from the metadata.
+func (m youtubeMeta) apply(ep *Episode) {
+	if m.Title != "" {
+		ep.Title = m.Title
+	}
+	if m.Uploader != "" {
+		ep.Host = m.Uploader
+	}
+	if len(m.UploadDate) >= 4 {
+		if year, err := strconv.Atoi(m.UploadDate[:4]); err == nil {
+			ep.Date = year
+		}
+	}
+	if m.Duration > 0 {
+		ep.Duration = time.Duration(m.Duration * float64(time.Second))
+	}
+	ep.Thumbnail = m.Thumbnail
+}
+
+// sizeUnits are the units of sizes printed by YouTube downloaders.
+var sizeUnits = []struct {
+	suffix string
+	mult   float64
+}{
+	{"GiB", 1 << 30},
+	{"MiB", 1 << 20},
+	{"KiB", 1 << 10},
+	{"B", 1},
+}
+
+// parseSize parses a size as printed by YouTube downloaders, such as
+// "12.34MiB" or "~1.2GiB" for an estimate.
+func parseSize(s string) (float64, bool) {
+	s = strings.TrimPrefix(s, "~")
+	for _, unit := range sizeUnits {
+		if strings.HasSuffix(s, unit.suffix) {
+			val, err := strconv.ParseFloat(strings.TrimSuffix(s, unit.suffix), 64)
+			return val * unit.mult, err == nil
+		}
+	}
+
+	return 0, false
+}
+
+// parseProgress parses the fields of a progress line printed by youtube-dl
+// after "[download]", such as:
+//
+//	45.3% of ~12.34MiB at 1.23MiB/s ETA 00:10
+//
+// The download must be locked by the caller.
+func (d *Download) parseProgress(fields []string) {
+	if !strings.HasSuffix(fields[0], "%") {
+		return
+	}
+
+	pc, err := strconv.ParseFloat(strings.TrimSuffix(fields[0], "%"), 64)
+	if err != nil {
+		return
+	}
+	d.Percentage = pc / 100
+
+	for i := 1; i < len(fields)-1; i++ {
+		switch fields[i] {
+		case "of":
+			if size, ok := parseSize(fields[i+1]); ok {
+				d.Size = int64(size)
+			}
+		case "at":
+			if rate, ok := parseSize(strings.TrimSuffix(fields[i+1], "/s")); ok {
+				d.sampleRate(rate)
+			}
+		}
+	}
+
+	if d.Size > 0 {
+		d.Done = int64(d.Percentage * float64(d.Size))
+	}
+}
+
+// parseTemplate parses the fields of a progress line printed by yt-dlp using
+// the progress template: the bytes downloaded, total bytes, estimated total
+// bytes and speed, any of which may be "NA".
+//
+// The download must be locked by the caller.
+func (d *Download) parseTemplate(fields []string) {
+	if len(fields) != 4 {
+		return
+	}
+
+	num := func(s string) float64 {
+		val, _ := strconv.ParseFloat(s, 64)
+		return val
+	}
+
+	done, total, estimate, speed := num(fields[0]), num(fields[1]), num(fields[2]), num(fields[3])
+	if total <= 0 {
+		total = estimate
+	}
+
+	d.Done = int64(done)
+	if total > 0 {
+		d.Size = int64(total)
+		d.Percentage = done / total
+	}
+	if speed > 0 {
+		d.sampleRate(speed)
+	}
+}
+
+// parseLine updates the download from a line of downloader output, returning
+// the message if the line reports an error.
+//
+// The download must be locked by the caller.
+func (d *Download) parseLine(line string) string {
+	fields := strings.Fields(line)
+	if len(fields) < 2 {
+		return ""
+	}
+
+	switch fields[0] {
+	case progressPrefix:
+		d.parseTemplate(fields[1:])
+	case "[download]":
+		d.parseProgress(fields[1:])
+	case "ERROR:":
+		return strings.Join(fields[1:], " ")
+	}
+
+	return ""
+}
+
+// youtubeArgs returns the arguments to loader to download url into dir, at
+// no more than limit bytes per second if above zero.
+func youtubeArgs(loader, dir, url string, limit int64) []string {
+	args := strings.Fields(YoutubeFlags)
+	args = append(args, "-f", YoutubeFormat, "--audio-format", YoutubeAudio)
+	args = append(args, "--user-agent", UserAgent)
+	if Proxy != "" {
+		args = append(args, "--proxy", Proxy)
+	}
+	if loader == YoutubeDLP {
+		args = append(args, "--progress-template", youtubeProgress)
+	}
+
+	// The downloader cannot share the global limit, so gets all of it
+	if RateLimit > 0 && (limit <= 0 || RateLimit < limit) {
+		limit = RateLimit
+	}
+	if limit > 0 {
+		args = append(args, "--limit-rate", strconv.FormatInt(limit, 10))
+	}
+
+	args = append(args, YoutubeArgs...)
+	return append(args, "-o", filepath.Join(dir, "audio.%(ext)s"), "--", url)
+}
+
+// youtubeOutput finds the audio file and info JSON written by the downloader
+// into dir. The audio file is expected in the configured audio format, but
+// any other file is accepted in case the downloader could not convert it.
+func youtubeOutput(dir string) (audio, info string) {
+	entries, _ := os.ReadDir(dir)
+	for _, elem := range entries {
+		name := elem.Name()
+		switch {
+		case name == "audio."+YoutubeAudio:
+			return filepath.Join(dir, name), filepath.Join(dir, "audio.info.json")
+		case strings.HasSuffix(name, ".info.json"):
+			info = filepath.Join(dir, name)
+		case strings.HasSuffix(name, ".part"), strings.HasSuffix(name, ".ytdl"), strings.HasSuffix(name, ".temp"):
+		default:
+			audio = filepath.Join(dir, name)
+		}
+	}
+
+	return
+}
+
+// DownloadYoutube selects an appropriate downloader (yt-dlp or
+// youtube-dl) and begins a YouTube download on the calling thread
+// (synchronously).
+//
+// The download is made into a temporary directory alongside the download
+// path, then moved into place once verified. The metadata reported by the
+// downloader is stored alongside the episode.
+//
+// Used internally by cache; avoid calling directly.
+func (d *Download) DownloadYoutube(hndl ev.Handler) {
+	d.Elem.RLock()
+	if !d.Elem.Youtube {
+		panic("download: downloading non-youtube with youtube-dl")
+	}
+	d.Elem.RUnlock()
+
+	// Work around "already downloaded" errors from youtube-dl
+	d.File.Close()
+	os.Remove(d.File.Name())
+
+	defer func() {
+		Downloads.downloadsMutex.Lock()
+		Downloads.ongoing--
+		Downloads.downloadsMutex.Unlock()
+
+		hndl.Post(ev.DownloadChanged)
+	}()
+
+	fail := func(msg string) {
+		d.mut.Lock()
+		d.Completed = true
+		d.Success = false
+		d.Error = msg
+		d.mut.Unlock()
+	}
+
+	// Determine downloader program - use yt-dlp if available, else use ytdl
+	loader := youtubeLoader()
+	if loader == "" {
+		fail("No YouTube downloader")
+		return
+	}
+
+	tmpdir, err := os.MkdirTemp(filepath.Dir(d.Path), ".podbit-ytdl-")
+	if err != nil {
+		fail("Directory IO Error")
+		return
+	}
+	defer os.RemoveAll(tmpdir)
+
+	d.Elem.RLock()
+	d.mut.RLock()
+	proc := exec.Command(loader, youtubeArgs(loader, tmpdir, d.Elem.URL, d.Limit)...)
+	d.mut.RUnlock()
+	d.Elem.RUnlock()
+
+	// Progress and errors may be written to either stream
+	r, err := proc.StdoutPipe()
+	if err != nil {
+		fail("Downloader IO Error")
+		return
+	}
+	proc.Stderr = proc.Stdout
+
+	if err := proc.Start(); err != nil {
+		fail("Downloader failed to start: " + err.Error())
+		return
+	}
+
+	lines := make(chan string)
+	go func() {
+		scanner := bufio.NewScanner(r)
+		for scanner.Scan() {
+			lines <- scanner.Text()
+		}
+		close(lines)
+	}()
+
+	var lastErr string
+	lastPost := time.Now()
+	for reading := true; reading; {
+		select {
+		case line, ok := <-lines:
+			if !ok {
+				reading = false
+				break
+			}
+
+			d.mut.Lock()
+			if msg := d.parseLine(line); msg != "" {
+				lastErr = msg
+			}
+			d.mut.Unlock()
+
+			if time.Since(lastPost) >= eventInterval {
+				hndl.Post(ev.DownloadChanged)
+				lastPost = time.Now()
+			}
+		case <-d.Stop:
+			proc.Process.Kill()
+			go func() {
+				for range lines {
+				}
+			}()
+			proc.Wait()
+
+			fail("Cancelled")
+			return
+		}
+	}
+
+	if err := proc.Wait(); err != nil {
+		if lastErr == "" {
+			lastErr = err.Error()
+		}
+
+		fail("Download failed: " + lastErr)
+		return
+	}
+
+	// Move from temp location, once verified
+	audio, info := youtubeOutput(tmpdir)
+	if audio == "" {
+		fail("Download failed: no audio file written")
+		return
+	}
+
+	err = checkMagic(audio)
+	if err == nil {
+		err = os.Rename(audio, d.Path)
+	}
+	if err != nil {
+		fail("Download failed: " + err.Error())
+		return
+	}
+
+	if info != "" {
+		var meta youtubeMeta
+		if buf, err := os.ReadFile(info); err == nil && json.Unmarshal(buf, &meta) == nil {
+			if buf, err := json.Marshal(meta); err == nil {
+				os.WriteFile(d.Path+MetaSuffix, buf, 0666)
+			}
+		}
+	}
+
+	// Final clean up
+	d.Elem.Lock()
+	d.Elem.State = StateReady
+
+	d.mut.Lock()
+	d.Completed = true
+	d.Success = true
+	if d.Size > 0 {
+		d.Done = d.Size
+	}
+	d.Percentage = 1
+
+	Downloads.downloadsMutex.Lock()
+	Downloads.loadFile(d.Elem.Path, false)
+	Downloads.downloadsMutex.Unlock()
+
+	d.mut.Unlock()
+	d.Elem.Unlock()
+}
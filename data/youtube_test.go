@@ -0,0 +1,102 @@
+package data_test
+
+import (
+	"math"
+	"testing"
+
+	"github.com/ejv2/podbit/data"
+)
+
+var SizeTests = []struct {
+	Size    string
+	Bytes   float64
+	Success bool
+}{
+	{"512B", 512, true},
+	{"1.5KiB", 1536, true},
+	{"12.34MiB", 12.34 * (1 << 20), true},
+	{"~1.2GiB", 1.2 * (1 << 30), true},
+	{"10MB", 0, false},
+	{"Unknown", 0, false},
+	{"", 0, false},
+}
+
+var ProgressTests = []struct {
+	Name    string
+	Lines   []string
+	Done    int64
+	Size    int64
+	Percent float64
+	Rate    float64
+	Error   string
+}{
+	{
+		Name:  "template",
+		Lines: []string{"[podbit] 1048576 4194304 NA 524288"},
+		Done:  1 << 20, Size: 4 << 20, Percent: 0.25, Rate: 1 << 19,
+	},
+	{
+		Name:  "template estimate",
+		Lines: []string{"[podbit] 1048576 NA 2097152.5 NA"},
+		Done:  1 << 20, Size: 2097152, Percent: 0.5,
+	},
+	{
+		Name:  "template unknown size",
+		Lines: []string{"[podbit] 2048 NA NA NA"},
+		Done:  2048,
+	},
+	{
+		Name:  "template smoothed rate",
+		Lines: []string{"[podbit] 0 100 NA 1000", "[podbit] 50 100 NA 2000"},
+		Done:  50, Size: 100, Percent: 0.5, Rate: 1300,
+	},
+	{
+		Name:  "youtube-dl",
+		Lines: []string{"[download]  50.0% of 2.00MiB at 1.00MiB/s ETA 00:01"},
+		Done:  1 << 20, Size: 2 << 20, Percent: 0.5, Rate: 1 << 20,
+	},
+	{
+		Name:  "youtube-dl destination",
+		Lines: []string{"[download] Destination: audio.webm", "[youtube] abc: Downloading webpage"},
+	},
+	{
+		Name:  "error",
+		Lines: []string{"[podbit] 2048 NA NA NA", "ERROR: [youtube] abc: Video unavailable"},
+		Done:  2048, Error: "[youtube] abc: Video unavailable",
+	},
+}
+
+// TestParseSize tests parsing of sizes printed by youtube-dl.
+func TestParseSize(t *testing.T) {
+	for _, elem := range SizeTests {
+		b, ok := data.ParseSize(elem.Size)
+		if ok != elem.Success {
+			t.Errorf("size %q: expected success %t, got %t", elem.Size, elem.Success, ok)
+			continue
+		}
+		if ok && math.Abs(b-elem.Bytes) > 1e-6 {
+			t.Errorf("size %q: expected %f bytes, got %f", elem.Size, elem.Bytes, b)
+		}
+	}
+}
+
+// TestParseProgress tests reading download progress and errors from the
+// output of the YouTube downloaders.
+func TestParseProgress(t *testing.T) {
+	for _, elem := range ProgressTests {
+		d, msg := data.ParseLines(elem.Lines)
+
+		if d.Done != elem.Done || d.Size != elem.Size {
+			t.Errorf("%s: expected %d of %d bytes, got %d of %d", elem.Name, elem.Done, elem.Size, d.Done, d.Size)
+		}
+		if math.Abs(d.Percentage-elem.Percent) > 1e-6 {
+			t.Errorf("%s: expected percentage %f, got %f", elem.Name, elem.Percent, d.Percentage)
+		}
+		if math.Abs(d.Rate-elem.Rate) > 1e-6 {
+			t.Errorf("%s: expected rate %f, got %f", elem.Name, elem.Rate, d.Rate)
+		}
+		if msg != elem.Error {
+			t.Errorf("%s: expected error %q, got %q", elem.Name, elem.Error, msg)
+		}
+	}
+}
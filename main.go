@@ -6,6 +6,7 @@ import (
 	"os"
 	"os/signal"
 	"path/filepath"
+	"strings"
 	"syscall"
 	"time"
 
@@ -39,6 +40,29 @@ var (
 var (
 	KeepPlayed = flag.Bool("nocleanup", false, "Disable cache cleanups and keep all finished items")
 	PurgeQueue = flag.Bool("purge", false, "Purge finished items from the queue file as well as disk")
+	Rewind     = flag.String("rewind", "", "Rewind rules for resuming after a pause, as \"<pause>:<rewind>\" pairs and a final catch-all \"<rewind>\" (default \"1m:0s,1h:10s,30s\")")
+	Prefetch   = flag.Int("prefetch", 2, "Number of upcoming queue items to download while an episode plays")
+	Budget     = flag.Int64("prefetch-budget", 0, "Maximum disk space in megabytes used by prefetched queue items (0 for unlimited)")
+	Finish     = flag.Float64("finish", 95, "Percentage of an episode which must be played for it to count as finished when stopped")
+	Workers    = flag.Int("downloads", 4, "Maximum number of downloads which may run at once")
+	Limit      = flag.Int64("limit", 0, "Maximum total download speed in kilobytes per second (0 for unlimited)")
+	LimitEach  = flag.Int64("limit-each", 0, "Maximum speed of each download in kilobytes per second (0 for unlimited)")
+	Windows    = flag.String("windows", "", "Comma separated times of day during which downloads may start, such as \"01:00-06:00\" (default any time)")
+	Connect    = flag.Duration("connect-timeout", data.ConnectTimeout, "Time allowed to connect to a server before a download fails (0 for no timeout)")
+	Idle       = flag.Duration("idle-timeout", data.IdleTimeout, "Time allowed without receiving data before a download fails (0 for no timeout)")
+	Proxy      = flag.String("proxy", "", "URL of the proxy to download through (default from the environment)")
+	UserAgent  = flag.String("user-agent", data.UserAgent, "User-Agent sent with download requests")
+	CABundle   = flag.String("ca-bundle", "", "PEM file of extra certificate authorities to trust for downloads")
+	YtFormat   = flag.String("yt-format", data.YoutubeFormat, "Format selected by the YouTube downloader")
+	YtAudio    = flag.String("yt-audio", data.YoutubeAudio, "Audio format to which YouTube downloads are converted")
+	YtArgs     = flag.String("yt-args", "", "Extra space separated arguments passed to the YouTube downloader")
+	YtDir      = flag.String("yt-dir", "", "Directory into which videos of expanded playlists are downloaded (default $PODBIT_DOWNLOAD_PATH or ~/Downloads/Podcasts)")
+	YtTemplate = flag.String("yt-template", data.ExpandTemplate, "Path of each video of an expanded playlist, relative to the download directory")
+	Expand     = flag.String("expand", "", "Add each video of a YouTube playlist or channel to the queue, then exit")
+	Watch      = flag.Bool("watch", false, "With -expand, also add new videos of the playlist or channel whenever the queue is reloaded")
+	Retries    = flag.Int("retries", 5, "Number of times a download is attempted before giving up")
+	Stream     = flag.Bool("stream", false, "Stream episodes which are not yet downloaded instead of waiting for the download")
+	Filters    = flag.String("filters", "", "Comma separated audio filters to apply by default (loudnorm, dynaudnorm, silence, eq or none)")
 )
 
 func banner() {
@@ -100,11 +124,95 @@ func initSignals(exit chan struct{}) {
 	}()
 }
 
+// offerResume asks the user if they would like to resume the episode which
+// was playing when podbit last exited.
+func offerResume(item *data.QueueItem) {
+	title := item.URL
+	if ep, ok := data.Downloads.Query(item.Path); ok && ep.Title != "" {
+		title = ep.Title
+	}
+
+	var pos uint64
+	if _, res, err := data.Stamps.Stat(item.Path); err == nil {
+		pos = *res
+	}
+
+	question := fmt.Sprintf("Resume %q at %s?", data.LimitString(title, 40), data.FormatTime(float64(pos)))
+	if pos == 0 {
+		question = fmt.Sprintf("Resume playing %q?", data.LimitString(title, 40))
+	}
+	ui.Confirm(question, func(yes bool) {
+		if yes {
+			sound.Plr.Release()
+			return
+		}
+
+		go ui.StatusMessage("Queue restored: press p to resume playing")
+	})
+}
+
+// configureData applies the flags which configure downloads.
+func configureData() {
+	if *Workers < 1 {
+		*Workers = 1
+	}
+	data.MaxDownloads = *Workers
+	data.MaxAttempts = *Retries
+	data.RateLimit = *Limit * 1024
+	data.DownloadLimit = *LimitEach * 1024
+	if *Windows != "" {
+		var err error
+		data.DownloadWindows, err = data.ParseWindows(*Windows)
+		if err != nil {
+			fmt.Println(err.Error())
+			os.Exit(1)
+		}
+	}
+	data.ConnectTimeout = *Connect
+	data.IdleTimeout = *Idle
+	data.Proxy = *Proxy
+	data.UserAgent = *UserAgent
+	data.CABundle = *CABundle
+	data.YoutubeFormat = *YtFormat
+	data.YoutubeAudio = *YtAudio
+	data.YoutubeArgs = strings.Fields(*YtArgs)
+	data.ExpandTemplate = *YtTemplate
+	if *YtDir != "" {
+		data.ExpandDir = *YtDir
+	}
+}
+
+// expand adds the videos of the playlist or channel given by -expand to the
+// queue file, then exits. As only the queue file is changed, this may be run
+// while podbit is running, which picks up the new entries when it next
+// reloads the queue.
+func expand() {
+	if err := data.InitQueue(); err != nil {
+		fmt.Println(err.Error())
+		os.Exit(1)
+	}
+
+	fmt.Printf("Listing %s...", *Expand)
+	added, err := data.ExpandPlaylist(*Expand, *Watch)
+	if err != nil {
+		fmt.Println("\n" + err.Error())
+		os.Exit(1)
+	}
+	fmt.Printf("done (added %d episodes)\n", added)
+
+	os.Exit(0)
+}
+
 func main() {
 	banner()
 	flag.Parse()
 	initDirs()
 	initSignals(exit)
+	configureData()
+
+	if *Expand != "" {
+		expand()
+	}
 
 	running, lock := alreadyRunning()
 	if running {
@@ -124,6 +232,28 @@ func main() {
 	go data.ReloadLoop(reload)
 
 	fmt.Print("Initialising sound system...")
+	if *Filters != "" {
+		sound.DefaultFilters = strings.Split(*Filters, ",")
+	}
+	if *Rewind != "" {
+		sound.RewindRules, err = sound.ParseRewind(*Rewind)
+		if err != nil {
+			fmt.Println("\n" + err.Error())
+			os.Exit(1)
+		}
+	}
+	if err = data.InitClient(); err != nil {
+		fmt.Println("\n" + err.Error())
+		os.Exit(1)
+	}
+	if *Finish <= 0 || *Finish > 100 {
+		fmt.Println("\nError: Finish percentage must be above 0 and at most 100")
+		os.Exit(1)
+	}
+	sound.FinishThreshold = *Finish / 100
+	sound.StreamDefault = *Stream
+	sound.PrefetchCount = *Prefetch
+	sound.PrefetchBudget = *Budget * 1024 * 1024
 	sound.Plr, err = sound.NewPlayer(events)
 	if err != nil {
 		fmt.Printf("\nError: Failed to initialise sound system: %s\n", err.Error())
@@ -131,6 +261,7 @@ func main() {
 	}
 	fmt.Println("done")
 
+	resume, held := sound.RestoreQueue()
 	go sound.Mainloop()
 	defer sound.Plr.Destroy()
 
@@ -146,6 +277,9 @@ func main() {
 	ui.InitUI(scr, ui.LibraryMenu, events, keystroke, newMen, reload)
 	go ui.RenderLoop()
 
+	// Allow the last cleanup to be undone
+	ui.RecordCleanup(data.GetTrash())
+
 	// Welcome message
 	startup := time.Since(now)
 	go ui.StatusMessage(fmt.Sprintf("Podbit v%d.%d.%d -- %d episodes of %d podcasts loaded in %.2fs",
@@ -155,6 +289,13 @@ func main() {
 		len(data.Q.Items), len(data.Q.GetPodcasts()),
 		startup.Seconds()))
 
+	// Offer to pick up where we left off
+	if resume != nil {
+		offerResume(resume)
+	} else if held {
+		go ui.StatusMessage("Queue restored: press p to resume playing")
+	}
+
 	// Run events handler and kickstart listeners
 	go events.Run()
 	events.Post(ev.Keystroke)
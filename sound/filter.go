@@ -0,0 +1,190 @@
+package sound
+
+import (
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/ejv2/podbit/data"
+)
+
+// Audio filter names.
+const (
+	FilterLoudnorm   = "loudnorm"
+	FilterDynaudnorm = "dynaudnorm"
+	FilterSilence    = "silence"
+	FilterEQ         = "eq"
+)
+
+// Filters maps each audio filter name to the mpv audio filter which
+// implements it. These are applied through mpv's "af" property.
+var Filters = map[string]string{
+	FilterLoudnorm:   "lavfi=[loudnorm=I=-16:TP=-1.5:LRA=11]",
+	FilterDynaudnorm: "lavfi=[dynaudnorm=f=250:g=31]",
+	FilterSilence:    "lavfi=[silenceremove=stop_periods=-1:stop_duration=1:stop_threshold=-45dB]",
+	FilterEQ:         "lavfi=[equalizer=f=100:t=q:w=1:g=-4,equalizer=f=3000:t=q:w=1:g=3]",
+}
+
+// filterOrder is the order in which filters are applied, regardless of the
+// order in which they were configured. Silence should be removed before the
+// remaining audio is equalised and then normalised.
+var filterOrder = []string{
+	FilterSilence,
+	FilterEQ,
+	FilterDynaudnorm,
+	FilterLoudnorm,
+}
+
+// DefaultFilters is the global filter chain used for podcasts which do not
+// configure their own. If nil, the persisted global chain is used instead.
+var DefaultFilters []string
+
+// A Chain is a set of audio filters, identified by name, which are applied
+// together to the player.
+type Chain map[string]bool
+
+// NewChain builds a chain from a list of filter names. Unknown filter names
+// are ignored.
+func NewChain(names []string) Chain {
+	c := make(Chain, len(names))
+	for _, n := range names {
+		if _, ok := Filters[n]; ok {
+			c[n] = true
+		}
+	}
+
+	return c
+}
+
+// Names returns the names of each filter in the chain in the order in which
+// they are applied.
+func (c Chain) Names() []string {
+	names := make([]string, 0, len(c))
+	for _, n := range filterOrder {
+		if c[n] {
+			names = append(names, n)
+		}
+	}
+
+	return names
+}
+
+// String returns the chain in the form expected by mpv's "af" property.
+func (c Chain) String() string {
+	af := make([]string, 0, len(c))
+	for _, n := range c.Names() {
+		af = append(af, Filters[n])
+	}
+
+	return strings.Join(af, ",")
+}
+
+// Copy returns a copy of the chain which can be modified independently.
+func (c Chain) Copy() Chain {
+	n := make(Chain, len(c))
+	for k, v := range c {
+		n[k] = v
+	}
+
+	return n
+}
+
+// chainFor returns the filter chain which should be used for an episode. This
+// is the podcast's own chain if it has configured one, otherwise the global
+// chain. The returned boolean is true if the podcast's chain was used.
+func (p *Player) chainFor(q *data.QueueItem) (Chain, bool) {
+	pod := data.DB.GetOwner(q.URL)
+	if pod.Options.Filters != nil {
+		return NewChain(pod.Options.Filters), true
+	}
+
+	return p.global.Copy(), false
+}
+
+// ToggleFilter toggles the named filter in the active filter chain and
+// applies the change immediately. If the current podcast does not configure
+// its own chain, the change is also made to the global chain and persists.
+//
+// The normalisation filters are mutually exclusive, so enabling one disables
+// the other.
+func (p *Player) ToggleFilter(name string) {
+	p.act <- actFilter
+	p.dat <- name
+}
+
+func (p *Player) toggleFilter(name string) {
+	if _, ok := Filters[name]; !ok {
+		return
+	}
+
+	if p.filters[name] {
+		delete(p.filters, name)
+	} else {
+		switch name {
+		case FilterLoudnorm:
+			delete(p.filters, FilterDynaudnorm)
+		case FilterDynaudnorm:
+			delete(p.filters, FilterLoudnorm)
+		}
+
+		p.filters[name] = true
+	}
+
+	p.applyFilters()
+	if !p.podFilters {
+		p.global = p.filters.Copy()
+		p.saveState()
+	}
+}
+
+// GetFilters returns the names of the filters in the active filter chain.
+//
+// This function is thread safe but may block until data is available.
+func (p *Player) GetFilters() []string {
+	p.act <- reqFilters
+
+	return (<-p.dat).([]string)
+}
+
+func (p *Player) applyFilters() {
+	if p.filters[FilterSilence] {
+		atomic.StoreInt32(&p.skipping, 1)
+	} else {
+		atomic.StoreInt32(&p.skipping, 0)
+	}
+
+	if p.ctrl != nil {
+		p.ctrl.SetProperty("af", p.filters.String())
+	}
+}
+
+// GetSaved returns the number of seconds of silence which have been skipped
+// while playing the current episode, including in previous sessions.
+//
+// This function is thread safe but may block until data is available.
+func (p *Player) GetSaved() float64 {
+	p.act <- reqSaved
+
+	return (<-p.dat).(float64)
+}
+
+func (p *Player) getSaved() float64 {
+	if p.Now == nil {
+		return 0
+	}
+
+	prev, _ := data.Stamps.Saved(p.Now.Path)
+	return prev.Seconds() + float64(atomic.LoadInt64(&p.saved))/1000
+}
+
+// commitSaved records any skipped silence measured while playing the current
+// episode in the cache.db. Should be called once playback of the episode
+// ends.
+func (p *Player) commitSaved() {
+	ms := atomic.SwapInt64(&p.saved, 0)
+	if p.Now == nil || ms <= 0 {
+		return
+	}
+
+	data.Stamps.AddSaved(p.Now.Path, time.Duration(ms)*time.Millisecond)
+}
@@ -0,0 +1,171 @@
+package sound
+
+import (
+	"math/rand"
+	"time"
+
+	"github.com/ejv2/podbit/data"
+)
+
+// Playback modes, which decide what is played after an episode ends.
+const (
+	// ModeNormal plays the queue through once, then stops.
+	ModeNormal = iota
+	// ModeRepeatQueue returns to the start of the queue once it is exhausted.
+	ModeRepeatQueue
+	// ModeRepeatOne plays each episode again once it has finished.
+	ModeRepeatOne
+	// ModeShuffle plays the rest of the queue in a random order.
+	ModeShuffle
+	// ModeContinue enqueues the next unplayed episode of the same podcast
+	// once the queue is exhausted.
+	ModeContinue
+	modeCount
+)
+
+// ModeNames are the names of each playback mode, indexed by mode.
+var ModeNames = [modeCount]string{"normal", "repeat", "repeat one", "shuffle", "continue"}
+
+// Playback mode state, protected by the queue lock.
+var (
+	mode       int
+	unshuffled []*data.QueueItem
+	shuffler   = rand.New(rand.NewSource(time.Now().UnixNano()))
+)
+
+// shuffle randomly reorders the items after the head, remembering the
+// original order so that it may be restored by unshuffle.
+//
+// Expects the queue lock to be held.
+func shuffle() {
+	unshuffled = append([]*data.QueueItem(nil), queue[head:]...)
+
+	pending := queue[head:]
+	shuffler.Shuffle(len(pending), func(i, j int) {
+		pending[i], pending[j] = pending[j], pending[i]
+	})
+}
+
+// unshuffle restores the order of the items after the head from before they
+// were shuffled. Items enqueued since are left at the end in the order they
+// were added.
+//
+// Expects the queue lock to be held.
+func unshuffle() {
+	pending := queue[head:]
+
+	left := make(map[*data.QueueItem]int, len(pending))
+	for _, elem := range pending {
+		left[elem]++
+	}
+
+	order := make([]*data.QueueItem, 0, len(pending))
+	for _, elem := range append(unshuffled, pending...) {
+		if left[elem] > 0 {
+			order = append(order, elem)
+			left[elem]--
+		}
+	}
+
+	copy(pending, order)
+	unshuffled = nil
+}
+
+// SetMode changes the playback mode. Entering shuffle mode shuffles the
+// remainder of the queue, and leaving it restores the original order.
+func SetMode(m int) {
+	if m < 0 || m >= modeCount {
+		return
+	}
+
+	mut.Lock()
+	defer mut.Unlock()
+
+	if m == mode {
+		return
+	}
+
+	if mode == ModeShuffle {
+		unshuffle()
+	}
+	if m == ModeShuffle {
+		shuffle()
+	}
+
+	mode = m
+	saveQueue()
+}
+
+// CycleMode changes to the next playback mode, returning the new mode.
+func CycleMode() int {
+	next := (GetMode() + 1) % modeCount
+	SetMode(next)
+
+	return next
+}
+
+// GetMode returns the current playback mode.
+func GetMode() int {
+	mut.RLock()
+	defer mut.RUnlock()
+
+	return mode
+}
+
+// nextEpisode returns the next unplayed episode of the same podcast as last,
+// after it in the podcast's episode list if possible, or nil if there are
+// none.
+func nextEpisode(last *data.QueueItem) *data.QueueItem {
+	if last == nil {
+		return nil
+	}
+
+	eps := data.Q.GetPodcastEpisodes(data.DB.GetFriendlyName(last.URL))
+
+	start := 0
+	for i, elem := range eps {
+		if elem == last {
+			start = i + 1
+			break
+		}
+	}
+
+	for i := range eps {
+		elem := eps[(start+i)%len(eps)]
+		if elem != last && (elem.State == data.StatePending || elem.State == data.StateReady) {
+			return elem
+		}
+	}
+
+	return nil
+}
+
+// next returns the next item to play according to the playback mode, as
+// with PopHead. If ended is true, last has just ended, and finished is true
+// if it ended by playing to the end.
+func next(ended, finished bool, last *data.QueueItem) (*data.QueueItem, bool) {
+	// Looked up before locking, as the data queue may call into us
+	var cont *data.QueueItem
+	if ended && GetMode() == ModeContinue {
+		cont = nextEpisode(last)
+	}
+
+	mut.Lock()
+	if ended && finished && mode == ModeRepeatOne && head > 0 {
+		head--
+	}
+
+	if ended && len(queue) > 0 && head >= len(queue) {
+		switch mode {
+		case ModeRepeatQueue:
+			head = 0
+		case ModeContinue:
+			if cont != nil {
+				queue = append(queue, cont)
+			}
+		}
+	}
+	mut.Unlock()
+
+	return PopHead()
+}
@@ -0,0 +1,141 @@
+package sound
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/ejv2/podbit/data"
+)
+
+const (
+	// QueueFilename is the name of the play queue file in the data directory.
+	QueueFilename = "playqueue"
+	// QueueComment is written at the top of the play queue file.
+	QueueComment = `# This is the podbit play queue file
+# It contains the play queue as it was when podbit last exited
+# Do not modify by hand`
+)
+
+// saveQueue writes the play queue to disk. The queue is written to a
+// temporary file which then replaces the saved queue, so that the saved
+// queue is never left partially written. The caller must hold the write lock
+// on the queue, so that only one save is made at a time.
+func saveQueue() error {
+	path := data.DataPath(QueueFilename)
+	f, err := os.CreateTemp(filepath.Dir(path), QueueFilename+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+
+	w := bufio.NewWriter(f)
+	w.WriteString(QueueComment + "\n\n")
+	fmt.Fprintf(w, "head %d\n", head)
+	fmt.Fprintf(w, "mode %d\n", mode)
+	for _, elem := range unshuffled {
+		fmt.Fprintf(w, "order %s\n", elem.URL)
+	}
+	for _, elem := range queue {
+		fmt.Fprintln(w, elem.URL)
+	}
+
+	// Write errors are kept by the buffer until flushed
+	if err := w.Flush(); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(f.Name(), path)
+}
+
+// SaveQueue writes the play queue to disk. This is done automatically on
+// every change to the queue, so should only be needed on exit.
+func SaveQueue() error {
+	mut.Lock()
+	defer mut.Unlock()
+
+	return saveQueue()
+}
+
+// RestoreQueue loads the play queue saved by a previous run, dropping any
+// entries which are no longer in the queue file. This must be called after
+// data has been initialised and before the sound mainloop is started.
+//
+// If any of the queue remains to be played, it is held until released by the
+// user, so that nothing plays on startup unasked, and held is true. If the
+// episode which was playing at exit was not finished, the queue is positioned
+// to play it again and it is returned, so that the user may be offered to
+// resume it. Otherwise, nil is returned.
+func RestoreQueue() (resume *data.QueueItem, held bool) {
+	f, err := os.Open(data.DataPath(QueueFilename))
+	if err != nil {
+		return nil, false
+	}
+	defer f.Close()
+
+	mut.Lock()
+	defer mut.Unlock()
+
+	saved, dropped, i := 0, 0, 0
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		elem := scanner.Text()
+		if len(elem) == 0 || strings.HasPrefix(elem, "#") {
+			continue
+		}
+
+		if strings.HasPrefix(elem, "head ") {
+			saved, _ = strconv.Atoi(strings.TrimPrefix(elem, "head "))
+			continue
+		}
+		if strings.HasPrefix(elem, "mode ") {
+			m, err := strconv.Atoi(strings.TrimPrefix(elem, "mode "))
+			if err == nil && m >= 0 && m < modeCount {
+				mode = m
+			}
+			continue
+		}
+		if strings.HasPrefix(elem, "order ") {
+			// Order of the queue before shuffling
+			if item := data.Q.GetEpisodeByURL(strings.TrimPrefix(elem, "order ")); item != nil {
+				unshuffled = append(unshuffled, item)
+			}
+			continue
+		}
+
+		item := data.Q.GetEpisodeByURL(elem)
+		if item == nil {
+			// Dropped entries before the head move it back
+			if i < saved {
+				dropped++
+			}
+		} else {
+			queue = append(queue, item)
+		}
+		i++
+	}
+
+	head = saved - dropped
+	if head < 0 {
+		head = 0
+	}
+	if head > len(queue) {
+		head = len(queue)
+	}
+
+	// Resume an unfinished head, whether or not it was stopped part way
+	if head > 0 && queue[head-1].State != data.StateFinished {
+		head--
+		resume = queue[head]
+	}
+
+	Plr.held = head < len(queue)
+	return resume, Plr.held
+}
@@ -0,0 +1,158 @@
+package sound
+
+import (
+	"os"
+	"sync"
+
+	"github.com/ejv2/podbit/data"
+)
+
+// Prefetch configuration.
+var (
+	// PrefetchCount is the number of upcoming queue items to download in
+	// the background while an episode plays. Zero disables prefetching.
+	PrefetchCount = 2
+	// PrefetchBudget is the maximum disk space in bytes which may be used by
+	// upcoming queue items before no more are prefetched. Zero is unlimited.
+	PrefetchBudget int64 = 0
+)
+
+// Prefetch state.
+var (
+	prefetchMut sync.RWMutex
+	prefetched  = make(map[*data.QueueItem]bool)
+	// sizes are the expected sizes of upcoming items, or -1 while the size
+	// is being requested
+	sizes = make(map[*data.QueueItem]int64)
+)
+
+// expectedSize returns the size of an upcoming item which is not yet
+// downloaded, as reported by the server. The size is requested in the
+// background, so ok is false until it is known. A size of zero is unknown.
+//
+// Expects the prefetch lock to be held.
+func expectedSize(elem *data.QueueItem) (size int64, ok bool) {
+	size, found := sizes[elem]
+	if found {
+		return size, size >= 0
+	}
+
+	// The downloader gives no size for YouTube videos
+	if elem.Youtube {
+		sizes[elem] = 0
+		return 0, true
+	}
+
+	sizes[elem] = -1
+	url := elem.URL
+	go func() {
+		n := data.ContentLength(url)
+
+		prefetchMut.Lock()
+		sizes[elem] = n
+		prefetchMut.Unlock()
+	}()
+
+	return 0, false
+}
+
+// queuedSize returns the disk space used by an upcoming queue item, if it
+// is downloaded or downloading.
+func queuedSize(elem *data.QueueItem) int64 {
+	if y, id := data.Downloads.IsDownloading(elem.Path); y {
+		if dl, ok := data.Downloads.GetDownload(id); ok && dl.Size > 0 {
+			return dl.Size
+		}
+	}
+
+	stat, err := os.Stat(elem.Path)
+	if err != nil {
+		stat, err = os.Stat(elem.Path + data.PartSuffix)
+	}
+	if err != nil {
+		return 0
+	}
+
+	return stat.Size()
+}
+
+// prefetch starts downloads of the next PrefetchCount items after the head
+// which are not yet downloaded, as long as the disk space used by upcoming
+// items, including the item to download, stays within PrefetchBudget. Each
+// item is only attempted once, so that failed downloads are not retried
+// endlessly.
+func prefetch() {
+	if PrefetchCount <= 0 {
+		return
+	}
+
+	mut.RLock()
+	pending := append([]*data.QueueItem(nil), queue[head:]...)
+	mut.RUnlock()
+
+	prefetchMut.Lock()
+	defer prefetchMut.Unlock()
+
+	// Forget items which have been played or dequeued
+	left := make(map[*data.QueueItem]bool, len(pending))
+	for _, elem := range pending {
+		left[elem] = true
+	}
+	for elem := range prefetched {
+		if !left[elem] {
+			delete(prefetched, elem)
+		}
+	}
+	for elem, size := range sizes {
+		if !left[elem] && size >= 0 {
+			delete(sizes, elem)
+		}
+	}
+
+	upcoming := pending
+	if len(upcoming) > PrefetchCount {
+		upcoming = upcoming[:PrefetchCount]
+	}
+
+	var used int64
+	for _, elem := range upcoming {
+		elem.RLock()
+		downloading, _ := data.Downloads.IsDownloading(elem.Path)
+		ready := elem.State != data.StatePending && data.Downloads.EntryExists(elem.Path)
+
+		if downloading || ready {
+			elem.RUnlock()
+			used += queuedSize(elem)
+			continue
+		}
+
+		if prefetched[elem] {
+			elem.RUnlock()
+			continue
+		}
+
+		// Stay within the budget once this item is downloaded too
+		if PrefetchBudget > 0 {
+			size, ok := expectedSize(elem)
+			if !ok || used+size > PrefetchBudget {
+				elem.RUnlock()
+				continue
+			}
+		}
+
+		data.Downloads.DownloadPriority(elem, data.PriorityQueue)
+		prefetched[elem] = true
+		elem.RUnlock()
+	}
+}
+
+// IsPrefetched returns true if item was downloaded ahead of time while
+// another episode was playing. Items which are still downloading, or failed
+// to download, are not prefetched.
+func IsPrefetched(item *data.QueueItem) bool {
+	prefetchMut.RLock()
+	attempted := prefetched[item]
+	prefetchMut.RUnlock()
+
+	return attempted && data.Downloads.EntryExists(item.Path)
+}
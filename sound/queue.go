@@ -6,6 +6,13 @@ import (
 	"github.com/ejv2/podbit/data"
 )
 
+// QueueState is a copy of the play queue and its head, which may be restored
+// later.
+type QueueState struct {
+	Items []*data.QueueItem
+	Head  int
+}
+
 // Singleton state.
 var (
 	mut sync.RWMutex
@@ -21,6 +28,28 @@ func Enqueue(item *data.QueueItem) {
 	defer mut.Unlock()
 
 	queue = append(queue, item)
+	saveQueue()
+}
+
+// EnqueueAll enqueues each of items for playback in order.
+func EnqueueAll(items []*data.QueueItem) {
+	mut.Lock()
+	defer mut.Unlock()
+
+	queue = append(queue, items...)
+	saveQueue()
+}
+
+// ReplaceQueue replaces the entire queue with items, stopping the current
+// episode and starting again from the beginning of the new queue.
+func ReplaceQueue(items []*data.QueueItem) {
+	mut.Lock()
+	queue = append([]*data.QueueItem(nil), items...)
+	head = 0
+	saveQueue()
+	mut.Unlock()
+
+	Plr.Stop()
 }
 
 // EnqueueByURL searches data sources for episodes under <url>
@@ -56,14 +85,17 @@ func EnqueueByTitle(title string) {
 func EnqueueByPodcast(ident string) {
 	comp := data.DB.GetFriendlyName(ident)
 
+	var items []*data.QueueItem
 	data.Q.Range(func(i int, elem *data.QueueItem) bool {
 		name := data.DB.GetFriendlyName(elem.URL)
 		if name == comp {
-			Enqueue(data.Q.Items[i]) // Do not return: we are queueing in bulk
+			items = append(items, elem) // Do not return: we are queueing in bulk
 		}
 
 		return true
 	})
+
+	EnqueueAll(items)
 }
 
 // JumpTo will force the head to the specified location.
@@ -71,11 +103,15 @@ func EnqueueByPodcast(ident string) {
 // After the jump, the player is instructed to play the
 // new head.
 func JumpTo(index int) {
+	mut.Lock()
 	if index >= len(queue) {
+		mut.Unlock()
 		return
 	}
 
 	head = index
+	saveQueue()
+	mut.Unlock()
 
 	Plr.Stop()
 }
@@ -87,10 +123,117 @@ func PlayNow(item *data.QueueItem) {
 	JumpTo(len(queue) - 1)
 }
 
+// PlayNext inserts an episode directly after the currently playing item,
+// such that it is the next item to be played.
+func PlayNext(item *data.QueueItem) {
+	mut.Lock()
+	defer mut.Unlock()
+
+	queue = append(queue, nil)
+	copy(queue[head+1:], queue[head:])
+	queue[head] = item
+
+	saveQueue()
+}
+
+// move moves the item at index from to index to, shifting items in between
+// and keeping the head pointing after the currently playing item. The
+// index to is clamped to the queue bounds. Returns the new index of the
+// item, or -1 if from was invalid.
+//
+// Expects the queue lock to be held.
+func move(from, to int) int {
+	if from < 0 || from >= len(queue) {
+		return -1
+	}
+	if to < 0 {
+		to = 0
+	}
+	if to >= len(queue) {
+		to = len(queue) - 1
+	}
+	if from == to {
+		return to
+	}
+
+	item := queue[from]
+	if from < to {
+		copy(queue[from:to], queue[from+1:to+1])
+	} else {
+		copy(queue[to+1:from+1], queue[to:from])
+	}
+	queue[to] = item
+
+	// Track the item before the head, which is playing (or has played)
+	if head > 0 {
+		cur := head - 1
+		switch {
+		case from == cur:
+			cur = to
+		case from < cur && to >= cur:
+			cur--
+		case from > cur && to <= cur:
+			cur++
+		}
+		head = cur + 1
+	}
+
+	saveQueue()
+	return to
+}
+
+// MoveUp moves the item at index one place towards the start of the queue.
+// Returns the new index of the item, or -1 if index was invalid.
+func MoveUp(index int) int {
+	mut.Lock()
+	defer mut.Unlock()
+
+	return move(index, index-1)
+}
+
+// MoveDown moves the item at index one place towards the end of the queue.
+// Returns the new index of the item, or -1 if index was invalid.
+func MoveDown(index int) int {
+	mut.Lock()
+	defer mut.Unlock()
+
+	return move(index, index+1)
+}
+
+// MoveToTop moves the item at index to the head of the queue, such that it
+// is the next item to be played, as with PlayNext. The item currently playing
+// is not moved. Returns the new index of the item, or -1 if index was invalid.
+func MoveToTop(index int) int {
+	mut.Lock()
+	defer mut.Unlock()
+
+	switch {
+	case index == head-1:
+		return index
+	case index < head-1:
+		// Items before the head shift down once this is removed
+		return move(index, head-1)
+	default:
+		return move(index, head)
+	}
+}
+
+// MoveToBottom moves the item at index to the end of the queue.
+// Returns the new index of the item, or -1 if index was invalid.
+func MoveToBottom(index int) int {
+	mut.Lock()
+	defer mut.Unlock()
+
+	return move(index, len(queue)-1)
+}
+
 // ClearQueue truncates the queue to zero items.
 func ClearQueue() {
+	mut.Lock()
 	queue = queue[:0]
 	head = 0
+	saveQueue()
+	mut.Unlock()
 
 	Plr.Stop()
 }
@@ -101,7 +244,7 @@ func Dequeue(index int) {
 	mut.Lock()
 	defer mut.Unlock()
 
-	if index >= len(queue) {
+	if index < 0 || index >= len(queue) {
 		return
 	}
 
@@ -128,6 +271,67 @@ func Dequeue(index int) {
 	if head < 0 {
 		head = 0
 	}
+
+	saveQueue()
+}
+
+// IndexOf returns the index of item in the queue, or -1 if it is not
+// enqueued. If item is enqueued more than once, the index closest to near is
+// returned.
+func IndexOf(item *data.QueueItem, near int) int {
+	mut.RLock()
+	defer mut.RUnlock()
+
+	index := -1
+	for i, elem := range queue {
+		if elem != item {
+			continue
+		}
+
+		if index < 0 || abs(i-near) < abs(index-near) {
+			index = i
+		}
+	}
+
+	return index
+}
+
+func abs(n int) int {
+	if n < 0 {
+		return -n
+	}
+
+	return n
+}
+
+// GetQueueState returns a copy of the current play queue and head.
+func GetQueueState() QueueState {
+	mut.RLock()
+	defer mut.RUnlock()
+
+	return QueueState{
+		Items: append([]*data.QueueItem(nil), queue...),
+		Head:  head,
+	}
+}
+
+// SetQueueState replaces the play queue and head with a copy saved by
+// GetQueueState. Playback is not affected, so the caller should stop the
+// player if the playing item is no longer before the head.
+func SetQueueState(s QueueState) {
+	mut.Lock()
+	defer mut.Unlock()
+
+	queue = append([]*data.QueueItem(nil), s.Items...)
+	head = s.Head
+	if head > len(queue) {
+		head = len(queue)
+	}
+	if head < 0 {
+		head = 0
+	}
+
+	saveQueue()
 }
 
 // GetQueue returns the raw queue in QueueItem slice form
@@ -155,6 +359,7 @@ func PopHead() (*data.QueueItem, bool) {
 
 		i := queue[head]
 		head++
+		saveQueue()
 
 		return i, false
 	}
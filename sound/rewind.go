@@ -0,0 +1,79 @@
+package sound
+
+import (
+	"errors"
+	"strings"
+	"time"
+)
+
+// ErrorRewindSyntax is returned when parsing an invalid set of rewind rules.
+var ErrorRewindSyntax = errors.New("Error: Malformed rewind rules: expected \"<pause>:<rewind>\" pairs followed by a final \"<rewind>\"")
+
+// A RewindRule specifies how far to rewind on resuming after a pause of less
+// than Under. A rule with a zero Under matches pauses of any length.
+type RewindRule struct {
+	Under  time.Duration
+	Rewind time.Duration
+}
+
+// RewindRules are the rules used to decide how far to rewind after a pause.
+// The rules are checked in order, with the first to match being used. If no
+// rule matches, no rewind takes place.
+var RewindRules = []RewindRule{
+	{time.Minute, 0},
+	{time.Hour, 10 * time.Second},
+	{0, 30 * time.Second},
+}
+
+// ParseRewind parses a set of rewind rules from a comma separated list of
+// "<pause>:<rewind>" pairs, optionally followed by a single "<rewind>" which
+// applies to pauses of any other length. Durations are in the format
+// accepted by time.ParseDuration. For example, the default rules are:
+//
+//	1m:0s,1h:10s,30s
+func ParseRewind(s string) ([]RewindRule, error) {
+	var rules []RewindRule
+
+	fields := strings.Split(s, ",")
+	for i, elem := range fields {
+		var rule RewindRule
+		var err error
+
+		pair := strings.SplitN(strings.TrimSpace(elem), ":", 2)
+		if len(pair) == 1 {
+			// Catch-all must be last
+			if i != len(fields)-1 {
+				return nil, ErrorRewindSyntax
+			}
+
+			rule.Rewind, err = time.ParseDuration(pair[0])
+		} else {
+			rule.Under, err = time.ParseDuration(pair[0])
+			if err == nil && rule.Under <= 0 {
+				err = ErrorRewindSyntax
+			}
+			if err == nil {
+				rule.Rewind, err = time.ParseDuration(pair[1])
+			}
+		}
+
+		if err != nil || rule.Rewind < 0 {
+			return nil, ErrorRewindSyntax
+		}
+
+		rules = append(rules, rule)
+	}
+
+	return rules, nil
+}
+
+// RewindFor returns the amount to rewind by after pausing for paused.
+func RewindFor(paused time.Duration) time.Duration {
+	for _, r := range RewindRules {
+		if r.Under == 0 || paused < r.Under {
+			return r.Rewind
+		}
+	}
+
+	return 0
+}
@@ -0,0 +1,209 @@
+package sound
+
+import (
+	"time"
+
+	"github.com/ejv2/podbit/data"
+	ev "github.com/ejv2/podbit/event"
+)
+
+// Sleep timer modes.
+const (
+	SleepOff     = iota // No sleep timer
+	SleepTimer          // Stop after a set amount of time
+	SleepEpisode        // Stop at the end of the current episode
+	SleepChapter        // Stop at the end of the current chapter
+)
+
+// Sleep timer settings.
+var (
+	// SleepStep is the amount of time each extension of the sleep timer
+	// adds.
+	SleepStep = 15 * time.Minute
+	// FadeTime is the amount of time over which the volume fades out before
+	// the sleep timer expires.
+	FadeTime = 30 * time.Second
+)
+
+// SleepState is the current state of the sleep timer, as returned by
+// GetSleep.
+type SleepState struct {
+	Mode      int
+	Remaining time.Duration
+}
+
+// chapterEnd returns the time at which the chapter containing pos ends. If
+// the current file has no chapters, the duration of the file is returned.
+func (p *Player) chapterEnd(pos, dur float64) float64 {
+	res, err := p.ctrl.Exec("get_property", "chapter-list")
+	if err != nil || res == nil {
+		return dur
+	}
+
+	list, ok := res.Data.([]interface{})
+	if !ok {
+		return dur
+	}
+
+	for _, elem := range list {
+		ch, ok := elem.(map[string]interface{})
+		if !ok {
+			continue
+		}
+
+		start, _ := ch["time"].(float64)
+		if start > pos {
+			return start
+		}
+	}
+
+	return dur
+}
+
+// sleepRemaining returns the time remaining until the sleep timer expires.
+func (p *Player) sleepRemaining() time.Duration {
+	switch p.sleepMode {
+	case SleepTimer:
+		return time.Until(p.sleepAt)
+	case SleepEpisode, SleepChapter:
+		if !p.playing {
+			return 0
+		}
+
+		pos, _ := p.ctrl.Position()
+		dur, _ := p.ctrl.Duration()
+		if p.outro > 0 && dur > float64(p.outro) {
+			dur -= float64(p.outro)
+		}
+
+		end := dur
+		if p.sleepMode == SleepChapter {
+			end = p.chapterEnd(pos, dur)
+		}
+
+		return time.Duration((end - pos) * float64(time.Second))
+	default:
+		return 0
+	}
+}
+
+// SetSleep starts a sleep timer with the given mode. For timed sleeps, the
+// timer is set to SleepStep, or extended by SleepStep if already running.
+// Passing SleepOff cancels any running sleep timer.
+func (p *Player) SetSleep(mode int) {
+	p.act <- actSleep
+	p.dat <- mode
+}
+
+func (p *Player) setSleep(mode int) {
+	switch mode {
+	case SleepTimer:
+		if p.sleepMode == SleepTimer {
+			p.sleepAt = p.sleepAt.Add(SleepStep)
+		} else {
+			p.sleepAt = time.Now().Add(SleepStep)
+		}
+	case SleepEpisode, SleepChapter:
+		if !p.playing {
+			return
+		}
+
+		// Without a further chapter, wait for the end of the episode
+		if mode == SleepChapter {
+			pos, _ := p.ctrl.Position()
+			dur, _ := p.ctrl.Duration()
+			if p.chapterEnd(pos, dur) == dur {
+				mode = SleepEpisode
+			}
+		}
+
+		p.sleepItem = p.Now
+	case SleepOff:
+		p.cancelSleep()
+		return
+	default:
+		return
+	}
+
+	p.sleepMode = mode
+}
+
+// cancelSleep clears the sleep timer and restores the volume if it was being
+// faded out.
+func (p *Player) cancelSleep() {
+	p.sleepMode = SleepOff
+	p.sleepItem = nil
+
+	if p.ctrl != nil {
+		p.ctrl.SetProperty("volume", p.volume)
+	}
+}
+
+// GetSleep returns the current state of the sleep timer.
+//
+// This function is thread safe but may block until data is available.
+func (p *Player) GetSleep() SleepState {
+	p.act <- reqSleep
+
+	return (<-p.dat).(SleepState)
+}
+
+func (p *Player) getSleep() SleepState {
+	if p.sleepMode == SleepOff {
+		return SleepState{SleepOff, 0}
+	}
+
+	return SleepState{p.sleepMode, p.sleepRemaining()}
+}
+
+// sleepTick updates the sleep timer, fading out the volume as it nears
+// expiry. Once a timed or chapter sleep expires, playback is paused and the
+// resume position is saved. Episode sleeps are handled by sleepEnded.
+func (p *Player) sleepTick() {
+	if p.sleepMode == SleepOff || (p.sleepMode == SleepEpisode && !p.playing) {
+		return
+	}
+
+	rem := p.sleepRemaining()
+	if rem > FadeTime {
+		return
+	}
+
+	if p.sleepMode == SleepEpisode || rem > 0 {
+		if p.playing && !p.isPaused() {
+			vol := float64(p.volume) * float64(rem) / float64(FadeTime)
+			if vol < 0 {
+				vol = 0
+			}
+			p.ctrl.SetProperty("volume", vol)
+		}
+
+		return
+	}
+
+	if p.playing {
+		p.pause()
+
+		pos, err := p.ctrl.Position()
+		if err == nil {
+			data.Stamps.Resume(p.Now.Path, uint64(pos))
+		}
+	}
+
+	p.cancelSleep()
+	go p.hndl.Post(ev.PlayerChanged)
+}
+
+// sleepEnded checks if the episode an episode sleep timer was waiting on has
+// finished and, if so, holds the queue so that nothing else plays.
+func (p *Player) sleepEnded() {
+	if p.sleepMode != SleepEpisode || p.playing {
+		return
+	}
+
+	if p.sleepItem == p.Now {
+		p.held = true
+		p.cancelSleep()
+		go p.hndl.Post(ev.PlayerChanged)
+	}
+}
@@ -14,9 +14,11 @@
 package sound
 
 import (
+	"errors"
 	"fmt"
 	"math"
 	"os/exec"
+	"sync/atomic"
 	"time"
 
 	"github.com/ejv2/podbit/data"
@@ -37,8 +39,22 @@ var (
 	PlayerArgs = []string{"--idle", "--no-video", "--input-ipc-server=" + PlayerRPC}
 	// UpdateTime is the time between queue checks and supervision updates.
 	UpdateTime = 500 * time.Millisecond
+	// DefaultVolume is the volume used when no volume has been persisted.
+	DefaultVolume = 100
+	// MaxVolume is the maximum volume which may be requested of the player.
+	MaxVolume = 100
+	// FinishThreshold is the fraction of an episode which must have been
+	// played when it is stopped for it to be considered finished.
+	FinishThreshold = 0.95
+	// LoadTimeout is the longest the player waits for a file or stream to
+	// start playing before giving up on it.
+	LoadTimeout = 15 * time.Second
 )
 
+// ErrorLoadFailed is returned when the player cannot start playing a file,
+// such as a stream which cannot be fetched.
+var ErrorLoadFailed = errors.New("Error: Player failed to load episode")
+
 // Internal: Types of actions.
 const (
 	actPause = iota
@@ -47,13 +63,43 @@ const (
 	actStop
 	actTerm
 	actSeek
+	actVolume
+	actMute
+	actDevice
+	actFilter
+	actSleep
+	actRelease
 
 	reqPaused
 	reqPlaying
 	reqWaiting
 	reqTimings
+	reqVolume
+	reqDevices
+	reqFilters
+	reqSleep
+	reqStreaming
+	reqSaved
+)
+
+// Intervals used while waiting for a file to load. A player which is idle
+// after loadGrace has dropped the file without it ever being seen loading.
+const (
+	loadPoll  = 50 * time.Millisecond
+	loadGrace = time.Second
 )
 
+// silenceThreshold is the minimum amount the player position must run ahead
+// of the wall clock between two updates for it to be counted as skipped
+// silence. This filters out jitter in the reported position.
+const silenceThreshold = 0.25
+
+// AudioDevice is an audio output device as reported by the player.
+type AudioDevice struct {
+	Name        string
+	Description string
+}
+
 // WaitFunc is the function to call waiting between each update.
 type WaitFunc func(u chan int)
 
@@ -61,6 +107,11 @@ type WaitFunc func(u chan int)
 // after the media has completed playing and becomes ineffective
 // until the next call to play.
 type Player struct {
+	// Accessed atomically, so must stay 64-bit aligned
+	saved int64 // milliseconds of silence skipped during this episode
+	seeks int64 // number of seeks made, so these are not counted as skipped
+	swaps int64 // number of switches from a stream to the downloaded file
+
 	proc *exec.Cmd
 
 	hndl   ev.Handler
@@ -73,12 +124,36 @@ type Player struct {
 	ipcc *mpv.IPCClient
 	ctrl *mpv.Client
 
-	waiting  bool
-	download *data.QueueItem
+	waiting    bool
+	download   *data.QueueItem
+	downloadID int
+
+	outro int
+
+	streaming bool
+	swapping  int32
+	swapName  atomic.Value // file name of the last file swapped to
 
 	exhausted  bool
 	playing    bool
 	manualStop bool
+	ended      bool
+	finished   bool
+	held       bool
+	pausedAt   time.Time
+
+	sleepMode int
+	sleepAt   time.Time
+	sleepItem *data.QueueItem
+
+	volume int
+	muted  bool
+	device string
+
+	global     Chain
+	filters    Chain
+	podFilters bool
+	skipping   int32
 
 	Now        *data.QueueItem
 	NowPlaying string
@@ -96,6 +171,7 @@ func updateWait(u chan int) {
 func endWait(u chan int) {
 	Plr.Wait()
 	time.Sleep(time.Second)
+	Plr.commitSaved()
 
 	Plr.playing = false
 	Plr.NowPlaying = ""
@@ -117,26 +193,29 @@ func endWait(u chan int) {
 		return true
 	})
 
+	Plr.ended, Plr.finished = true, !Plr.manualStop
 	Plr.manualStop = false
 	Plr.hndl.Post(ev.PlayerChanged)
 	u <- 1
 }
 
 func downloadWait(u chan int) {
-	var id int
-	for y := true; y && DownloadAtHead(Plr.download); y, id = data.Downloads.IsDownloading(Plr.download.Path) {
+	for y := true; y && DownloadAtHead(Plr.download); y, _ = data.Downloads.IsDownloading(Plr.download.Path) {
 		<-Plr.dlchan
 	}
 
 	Plr.waiting = false
 
-	dl := data.Downloads.GetDownload(id)
+	dl, ok := data.Downloads.GetDownload(Plr.downloadID)
 
 	// Only attempt to play if
 	//	a) still present
 	//	b) the download succeeded
-	if DownloadAtHead(Plr.download) && dl.Success {
+	if DownloadAtHead(Plr.download) && ok && dl.Success {
+		mut.Lock()
 		head--
+		saveQueue()
+		mut.Unlock()
 	}
 
 	Plr.hndl.Post(ev.PlayerChanged)
@@ -153,6 +232,14 @@ func NewPlayer(events *ev.Handler) (p Player, err error) {
 	p.hndl = *events
 	p.event = events.Register()
 
+	p.volume = DefaultVolume
+	p.global = make(Chain)
+	p.loadState()
+	if DefaultFilters != nil {
+		p.global = NewChain(DefaultFilters)
+	}
+	p.filters = p.global.Copy()
+
 	return
 }
 
@@ -182,6 +269,12 @@ func (p *Player) start() {
 	for err := p.connect(); err != nil; {
 		err = p.connect()
 	}
+
+	p.ctrl.SetProperty("volume", p.volume)
+	p.applyFilters()
+	if p.device != "" {
+		p.ctrl.SetProperty("audio-device", p.device)
+	}
 }
 
 func (p *Player) procWatcher() {
@@ -191,27 +284,56 @@ func (p *Player) procWatcher() {
 	p.hndl.Post(ev.RequestShutdown)
 }
 
-func (p *Player) load(filename string, starttime int) {
+func (p *Player) load(filename string, starttime int, mode string) error {
 	if p.proc == nil || p.ctrl == nil {
 		p.start()
 	}
 
-	p.ctrl.Loadfile(filename, mpv.LoadFileModeAppendPlay)
-
-	// Wait for track to load
-	for loaded := ""; loaded != "\""+filename+"\""; loaded, _ = p.ctrl.Path() {
+	if err := p.ctrl.Loadfile(filename, mode); err != nil {
+		return ErrorLoadFailed
 	}
+
+	// Wait for the track to start playing. A file which fails to load is
+	// dropped by mpv, which then goes idle or moves on to another file.
+	start := time.Now()
+	seen := false
 	for {
-		pos, _ := p.ctrl.PercentPosition()
-		if pos != 0 {
+		if time.Since(start) > LoadTimeout {
+			p.ctrl.Exec("stop")
+			return ErrorLoadFailed
+		}
+		time.Sleep(loadPoll)
+
+		loaded, _ := p.ctrl.Path()
+		if loaded != "\""+filename+"\"" {
+			idle, _ := p.ctrl.GetBoolProperty("idle-active")
+			if seen || (idle && time.Since(start) > loadGrace) {
+				return ErrorLoadFailed
+			}
+
+			continue
+		}
+		seen = true
+
+		// The position is known once playback starts, even for streams
+		// of unknown length
+		if _, err := p.ctrl.Position(); err == nil {
 			break
 		}
 	}
 
 	p.ctrl.Seek(starttime, mpv.SeekModeAbsolute)
+	return nil
+}
+
+func (p *Player) play(q *data.QueueItem) error {
+	return p.playFrom(q, q.Path)
 }
 
-func (p *Player) play(q *data.QueueItem) {
+// playFrom plays q, reading the audio from src, which is either the local
+// file or a URL to stream from. Returns ErrorLoadFailed if src could not be
+// played, in which case nothing is playing.
+func (p *Player) playFrom(q *data.QueueItem, src string) error {
 	_, s, err := data.Stamps.Stat(q.Path)
 	if err != nil {
 		tmp := uint64(0)
@@ -222,9 +344,30 @@ func (p *Player) play(q *data.QueueItem) {
 		s = &tmp
 	}
 
-	p.load(q.Path, int(*s))
+	// Skip the intro when starting afresh, otherwise rewind based on how
+	// long ago we were last listening
+	opts := data.DB.GetOwner(q.URL).Options
+	if *s == 0 {
+		*s = uint64(opts.Intro)
+	} else if listened, err := data.Stamps.Listened(q.Path); err == nil {
+		rw := uint64(RewindFor(time.Since(listened)).Seconds())
+		if rw > *s {
+			rw = *s
+		}
+		*s -= rw
+	}
+	p.outro = opts.Outro
+
+	p.filters, p.podFilters = p.chainFor(q)
+	p.applyFilters()
+
+	if err := p.load(src, int(*s), mpv.LoadFileModeAppendPlay); err != nil {
+		return err
+	}
+	p.pausedAt = time.Time{}
+	p.streaming = src != q.Path
 
-	if q.State != data.StatePending {
+	if q.State != data.StatePending || p.streaming {
 		Plr.Now = q
 
 		now, ok := data.Downloads.Query(q.Path)
@@ -244,6 +387,8 @@ func (p *Player) play(q *data.QueueItem) {
 		p.playing = true
 		p.unpause()
 	}
+
+	return nil
 }
 
 // Stop ends playback of the current audio track, but does not
@@ -254,6 +399,12 @@ func (p *Player) Stop() {
 }
 
 func (p *Player) stop() {
+	// Manually stopping overrides waiting for the episode to end
+	p.held = false
+	if p.sleepMode == SleepEpisode || p.sleepMode == SleepChapter {
+		p.cancelSleep()
+	}
+
 	if !p.playing {
 		return
 	}
@@ -261,16 +412,37 @@ func (p *Player) stop() {
 	Plr.NowPlaying = ""
 	Plr.NowPodcast = ""
 	p.manualStop = true
+	p.commitSaved()
 
 	pos, err := p.ctrl.Position()
 	if err == nil {
-		data.Stamps.Resume(p.Now.Path, uint64(pos))
+		dur, derr := p.ctrl.Duration()
+		if derr == nil && dur > 0 && pos/dur >= FinishThreshold {
+			// Close enough to the end to count as finished
+			p.Now.Lock()
+			p.Now.State = data.StateFinished
+			p.Now.Unlock()
+
+			data.Stamps.Touch(p.Now.Path)
+		} else {
+			data.Stamps.Resume(p.Now.Path, uint64(pos))
+		}
+
+		if derr == nil && dur > 0 {
+			data.Stamps.SetLength(p.Now.Path, uint64(dur))
+		}
 	}
 
 	p.ctrl.Exec("stop")
 	p.playing = false
 }
 
+// Release allows the queue to continue playing after it was held, either by
+// the sleep timer or on restoring the queue at startup.
+func (p *Player) Release() {
+	p.act <- actRelease
+}
+
 // Destroy forces the current player instance to terminate and destroys
 // the sound mainloop.
 // Blocks until the process is guaranteed destroyed.
@@ -338,6 +510,9 @@ func (p *Player) pause() {
 	}
 
 	// Leave playing set to true so we know not to play another episode
+	if !p.isPaused() {
+		p.pausedAt = time.Now()
+	}
 	p.ctrl.SetPause(true)
 }
 
@@ -354,20 +529,44 @@ func (p *Player) unpause() {
 	}
 
 	// Leave playing set to true so we know not to play another episode
+	if p.isPaused() {
+		p.rewind()
+	}
 	p.ctrl.SetPause(false)
 }
 
+// rewind seeks backwards based on how long the player has been paused for.
+func (p *Player) rewind() {
+	if p.pausedAt.IsZero() {
+		return
+	}
+
+	rw := RewindFor(time.Since(p.pausedAt))
+	p.pausedAt = time.Time{}
+	if rw > 0 {
+		p.seek(-int(rw.Seconds()))
+	}
+}
+
 // Toggle pauses if the mainloop is unpaused, otherwise unpauses.
 func (p *Player) Toggle() {
 	p.act <- actToggle
 }
 
 func (p *Player) toggle() {
+	// Resume the queue if held by the sleep timer
+	p.held = false
+
 	if !p.playing {
 		return
 	}
 
 	paused, _ := p.ctrl.Pause()
+	if paused {
+		p.rewind()
+	} else {
+		p.pausedAt = time.Now()
+	}
 	p.ctrl.SetPause(!paused)
 }
 
@@ -407,9 +606,122 @@ func (p *Player) seek(off int) {
 		return
 	}
 
+	atomic.AddInt64(&p.seeks, 1)
 	p.ctrl.Seek(off, mpv.SeekModeRelative)
 }
 
+// ChangeVolume moves the player volume relative to the current volume. The
+// volume is kept within the range of zero to MaxVolume. Changing the volume
+// implicitly unmutes the player.
+func (p *Player) ChangeVolume(off int) {
+	p.act <- actVolume
+	p.dat <- off
+}
+
+func (p *Player) changeVolume(off int) {
+	p.volume += off
+	if p.volume < 0 {
+		p.volume = 0
+	}
+	if p.volume > MaxVolume {
+		p.volume = MaxVolume
+	}
+	p.muted = false
+
+	if p.ctrl != nil {
+		p.ctrl.SetProperty("volume", p.volume)
+		p.ctrl.SetMute(false)
+	}
+	p.saveState()
+}
+
+// ToggleMute mutes the player if unmuted, otherwise unmutes.
+func (p *Player) ToggleMute() {
+	p.act <- actMute
+}
+
+func (p *Player) toggleMute() {
+	p.muted = !p.muted
+
+	if p.ctrl != nil {
+		p.ctrl.SetMute(p.muted)
+	}
+}
+
+// GetVolume returns the current volume of the player and if the player is
+// currently muted.
+//
+// This function is thread safe but may block until data is available.
+func (p *Player) GetVolume() (int, bool) {
+	p.act <- reqVolume
+
+	dat := (<-p.dat).([2]int)
+	return dat[0], dat[1] != 0
+}
+
+func (p *Player) getVolume() (int, bool) {
+	return p.volume, p.muted
+}
+
+// SetDevice switches audio output to the device with the given name, as
+// returned by GetDevices. The device selection persists between runs.
+func (p *Player) SetDevice(name string) {
+	p.act <- actDevice
+	p.dat <- name
+}
+
+func (p *Player) setDevice(name string) {
+	p.device = name
+
+	if p.ctrl != nil {
+		p.ctrl.SetProperty("audio-device", name)
+	}
+	p.saveState()
+}
+
+// GetDevices returns all audio output devices known to the player along with
+// the name of the device currently in use. The player process is started if
+// it is not already running.
+//
+// This function is thread safe but may block until data is available.
+func (p *Player) GetDevices() ([]AudioDevice, string) {
+	p.act <- reqDevices
+
+	devs := (<-p.dat).([]AudioDevice)
+	cur := (<-p.dat).(string)
+	return devs, cur
+}
+
+func (p *Player) getDevices() []AudioDevice {
+	if p.proc == nil || p.ctrl == nil {
+		p.start()
+	}
+
+	res, err := p.ctrl.Exec("get_property", "audio-device-list")
+	if err != nil || res == nil {
+		return nil
+	}
+
+	list, ok := res.Data.([]interface{})
+	if !ok {
+		return nil
+	}
+
+	devs := make([]AudioDevice, 0, len(list))
+	for _, elem := range list {
+		dev, ok := elem.(map[string]interface{})
+		if !ok {
+			continue
+		}
+
+		name, _ := dev["name"].(string)
+		desc, _ := dev["description"].(string)
+		devs = append(devs, AudioDevice{name, desc})
+	}
+
+	return devs
+}
+
 // Wait for the current episode to complete.
 func (p *Player) Wait() {
 	if !p.playing {
@@ -417,11 +729,49 @@ func (p *Player) Wait() {
 	}
 
 	now, _ := p.ctrl.Filename()
-	for filename := now; filename == now; filename, _ = p.ctrl.Filename() {
-		if !p.isPaused() {
+	lastPos, _ := p.ctrl.Position()
+	lastTime := time.Now()
+	lastSeeks := atomic.LoadInt64(&p.seeks)
+	track := newSwapTracker(now, atomic.LoadInt64(&p.swaps))
+
+	for {
+		// Switching from a stream to the downloaded file changes the
+		// filename, but is not the end of the episode
+		filename, _ := p.ctrl.Filename()
+		swapping := atomic.LoadInt32(&p.swapping) != 0
+		swaps := atomic.LoadInt64(&p.swaps)
+		swapName, _ := p.swapName.Load().(string)
+		if track.ended(filename, swapping, swaps, swapName) {
+			break
+		}
+
+		paused := p.isPaused()
+		if !paused {
 			p.hndl.Post(ev.PlayerChanged)
 		}
 		time.Sleep(UpdateTime)
+
+		pos, _ := p.ctrl.Position()
+
+		// Once the outro is reached, the episode is over
+		if p.outro > 0 {
+			dur, _ := p.ctrl.Duration()
+			if dur > float64(p.outro) && pos >= dur-float64(p.outro) {
+				p.ctrl.Exec("stop")
+			}
+		}
+
+		// Measure skipped silence as the distance the position has run
+		// ahead of the clock, excluding any intervals containing seeks.
+		seeks := atomic.LoadInt64(&p.seeks)
+		if !paused && seeks == lastSeeks && atomic.LoadInt32(&p.skipping) != 0 {
+			ahead := (pos - lastPos) - time.Since(lastTime).Seconds()
+			if ahead >= silenceThreshold {
+				atomic.AddInt64(&p.saved, int64(ahead*1000))
+			}
+		}
+
+		lastPos, lastTime, lastSeeks = pos, time.Now(), seeks
 	}
 }
 
@@ -444,37 +794,48 @@ func Mainloop() {
 	var wait WaitFunc
 	var elem *data.QueueItem
 	u := make(chan int)
+	tick := time.NewTicker(UpdateTime)
+	defer tick.Stop()
 
 	for {
 		wait = updateWait
-		elem, Plr.exhausted = PopHead()
+		Plr.sleepEnded()
+		if !Plr.held {
+			elem, Plr.exhausted = next(Plr.ended, Plr.finished, Plr.Now)
+			Plr.ended, Plr.finished = false, false
+		}
 
-		if !Plr.playing && !Plr.waiting && !Plr.exhausted && len(queue) > 0 {
+		if !Plr.held && !Plr.playing && !Plr.waiting && !Plr.exhausted && len(queue) > 0 {
 			if elem.State != data.StatePending && data.Downloads.EntryExists(elem.Path) {
 				elem.Lock()
 
-				Plr.play(elem)
-				wait = endWait
+				// An episode which cannot be played is skipped
+				if Plr.play(elem) == nil {
+					wait = endWait
 
-				// Set status to played
-				elem.State = data.StatePlayed
-				data.Stamps.Touch(elem.Path)
+					// Set status to played
+					elem.State = data.StatePlayed
+					data.Stamps.Touch(elem.Path)
+				}
 
 				elem.Unlock()
+			} else if shouldStream(elem) && Plr.stream(elem) {
+				wait = endWait
 			} else {
 				Plr.waiting = true
 
 				elem.RLock()
-				if y, _ := data.Downloads.IsDownloading(elem.Path); y {
-					Plr.download = elem
+				if y, id := data.Downloads.IsDownloading(elem.Path); y {
+					data.Downloads.Prioritise(elem.Path, data.PriorityPlayer)
+					Plr.download, Plr.downloadID = elem, id
 				} else {
-
-					_, err := data.Downloads.Download(elem)
+					id, err := data.Downloads.DownloadPriority(elem, data.PriorityPlayer)
 					if err != nil {
+						elem.RUnlock()
 						continue
 					}
 
-					Plr.download = elem
+					Plr.download, Plr.downloadID = elem, id
 				}
 
 				elem.RUnlock()
@@ -488,6 +849,12 @@ func Mainloop() {
 			select {
 			case <-u:
 				keepWaiting = false
+			case <-tick.C:
+				Plr.sleepTick()
+				if Plr.playing {
+					prefetch()
+					Plr.streamTick()
+				}
 			case e := <-Plr.event:
 				Plr.Event(e)
 			case action := <-Plr.act:
@@ -497,6 +864,7 @@ func Mainloop() {
 						Plr.stop()
 						Plr.proc.Process.Kill()
 					}
+					SaveQueue()
 
 					Plr.dat <- 1
 					return
@@ -511,6 +879,22 @@ func Mainloop() {
 				case actSeek:
 					dat := <-Plr.dat
 					Plr.seek(dat.(int))
+				case actVolume:
+					dat := <-Plr.dat
+					Plr.changeVolume(dat.(int))
+				case actMute:
+					Plr.toggleMute()
+				case actDevice:
+					dat := <-Plr.dat
+					Plr.setDevice(dat.(string))
+				case actFilter:
+					dat := <-Plr.dat
+					Plr.toggleFilter(dat.(string))
+				case actSleep:
+					dat := <-Plr.dat
+					Plr.setSleep(dat.(int))
+				case actRelease:
+					Plr.held = false
 
 				case reqPaused:
 					Plr.dat <- Plr.isPaused()
@@ -518,11 +902,35 @@ func Mainloop() {
 					Plr.dat <- Plr.isPlaying()
 				case reqWaiting:
 					Plr.dat <- Plr.isWaiting()
+				case reqStreaming:
+					Plr.dat <- Plr.playing && Plr.streaming
 				case reqTimings:
 					d, p := Plr.getTimings()
 					arr := [2]float64{d, p}
 
 					Plr.dat <- arr
+				case reqVolume:
+					v, m := Plr.getVolume()
+					arr := [2]int{v, 0}
+					if m {
+						arr[1] = 1
+					}
+
+					Plr.dat <- arr
+				case reqSleep:
+					Plr.dat <- Plr.getSleep()
+				case reqSaved:
+					Plr.dat <- Plr.getSaved()
+				case reqFilters:
+					Plr.dat <- Plr.filters.Names()
+				case reqDevices:
+					Plr.dat <- Plr.getDevices()
+
+					cur := Plr.device
+					if cur == "" {
+						cur = "auto"
+					}
+					Plr.dat <- cur
 				}
 			}
 		}
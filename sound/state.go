@@ -0,0 +1,104 @@
+package sound
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/ejv2/podbit/data"
+)
+
+const (
+	// StateFilename is the name of the player state file in the data
+	// directory.
+	StateFilename = "player"
+	// StateComment is written at the top of the player state file.
+	StateComment = `# This is the podbit player state file
+# It contains player settings which persist between runs
+# Do not modify by hand`
+)
+
+// readState reads the player state file into a map of keys to values. A
+// missing or unreadable state file simply results in an empty map.
+func readState() map[string]string {
+	state := make(map[string]string)
+
+	f, err := os.Open(data.DataPath(StateFilename))
+	if err != nil {
+		return state
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		elem := scanner.Text()
+		if len(elem) == 0 || strings.HasPrefix(elem, "#") {
+			continue
+		}
+
+		fields := strings.SplitN(elem, " ", 2)
+		if len(fields) < 2 {
+			continue
+		}
+
+		state[fields[0]] = fields[1]
+	}
+
+	return state
+}
+
+// writeState truncates the player state file and writes out each key in
+// state alongside its value.
+func writeState(state map[string]string) error {
+	f, err := os.Create(data.DataPath(StateFilename))
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	f.WriteString(StateComment + "\n\n")
+	for key, val := range state {
+		if val == "" {
+			continue
+		}
+
+		fmt.Fprintf(f, "%s %s\n", key, val)
+	}
+
+	return nil
+}
+
+// loadState restores persisted player settings into p. Must be called before
+// the player process is started for the settings to take effect.
+func (p *Player) loadState() {
+	state := readState()
+
+	if v, ok := state["volume"]; ok {
+		vol, err := strconv.Atoi(v)
+		if err == nil && vol >= 0 && vol <= MaxVolume {
+			p.volume = vol
+		}
+	}
+	p.device = state["device"]
+
+	if f, ok := state["filters"]; ok && f != "none" {
+		p.global = NewChain(strings.Split(f, ","))
+	}
+}
+
+// saveState persists the current player settings to disk.
+func (p *Player) saveState() {
+	state := readState()
+
+	state["volume"] = strconv.Itoa(p.volume)
+	state["device"] = p.device
+
+	state["filters"] = strings.Join(p.global.Names(), ",")
+	if state["filters"] == "" {
+		state["filters"] = "none"
+	}
+
+	writeState(state)
+}
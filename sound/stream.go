@@ -0,0 +1,156 @@
+package sound
+
+import (
+	"path/filepath"
+	"sync/atomic"
+
+	"github.com/ejv2/podbit/data"
+
+	"github.com/blang/mpv"
+)
+
+// StreamDefault causes HTTP episodes which are not yet downloaded to be
+// streamed while downloading, rather than waiting for the download.
+var StreamDefault = false
+
+// streamItems are the episodes marked to be streamed, protected by the queue
+// lock.
+var streamItems = make(map[*data.QueueItem]bool)
+
+// StreamNow enqueues an episode and jumps to it, as with PlayNow, except
+// that it is streamed if it is not yet downloaded.
+func StreamNow(item *data.QueueItem) {
+	mut.Lock()
+	streamItems[item] = true
+	mut.Unlock()
+
+	PlayNow(item)
+}
+
+// shouldStream returns true if item should be streamed rather than waiting
+// for it to download. Only HTTP episodes can be streamed.
+func shouldStream(item *data.QueueItem) bool {
+	if item.Youtube {
+		return false
+	}
+
+	mut.RLock()
+	defer mut.RUnlock()
+
+	return StreamDefault || streamItems[item]
+}
+
+// IsStreaming returns true if the current episode is playing from its URL
+// rather than the downloaded file.
+func (p *Player) IsStreaming() bool {
+	p.act <- reqStreaming
+
+	r := <-p.dat
+	return r.(bool)
+}
+
+// stream starts playing q from its URL, downloading it in the background if
+// not already downloading. Returns false if the download could not be
+// started or the stream could not be played, in which case nothing is
+// played and the caller should wait for the download instead.
+func (p *Player) stream(q *data.QueueItem) bool {
+	q.Lock()
+	defer q.Unlock()
+
+	if y, _ := data.Downloads.IsDownloading(q.Path); !y {
+		if _, err := data.Downloads.DownloadPriority(q, data.PriorityPlayer); err != nil {
+			return false
+		}
+	} else {
+		data.Downloads.Prioritise(q.Path, data.PriorityPlayer)
+	}
+
+	mut.Lock()
+	delete(streamItems, q)
+	mut.Unlock()
+
+	// Streamed through podbit, so that the headers and credentials of the
+	// podcast are sent as for the download
+	src, err := data.StreamURL(q.URL)
+	if err != nil {
+		return false
+	}
+
+	if p.playFrom(q, src) != nil {
+		return false
+	}
+
+	// Set status to played, as for downloaded episodes
+	q.State = data.StatePlayed
+	data.Stamps.Touch(q.Path)
+
+	return true
+}
+
+// streamTick switches the player from the stream to the downloaded file
+// once the download is complete, carrying over the current position.
+func (p *Player) streamTick() {
+	if !p.streaming || p.Now == nil || p.isPaused() {
+		return
+	}
+
+	p.Now.RLock()
+	path := p.Now.Path
+	ready := data.Downloads.EntryExists(path)
+	p.Now.RUnlock()
+
+	if y, _ := data.Downloads.IsDownloading(path); y || !ready {
+		return
+	}
+
+	pos, err := p.ctrl.Position()
+	if err != nil {
+		return
+	}
+
+	atomic.StoreInt32(&p.swapping, 1)
+	atomic.AddInt64(&p.seeks, 1)
+	p.swapName.Store(filepath.Base(path))
+
+	// Should the file fail to load, the episode ends as if stopped, so
+	// that it is resumed from here next time
+	if err := p.load(path, int(pos), mpv.LoadFileModeReplace); err != nil {
+		p.manualStop = true
+		data.Stamps.Resume(path, uint64(pos))
+	}
+	p.streaming = false
+
+	atomic.AddInt64(&p.swaps, 1)
+	atomic.StoreInt32(&p.swapping, 0)
+}
+
+// A swapTracker decides when the episode being waited on has ended, which is
+// when mpv is playing a different file. Switching from a stream to the
+// downloaded file also changes the file, so the names of both are accepted
+// once a swap has happened.
+type swapTracker struct {
+	names     map[string]bool
+	lastSwaps int64
+}
+
+func newSwapTracker(filename string, swaps int64) *swapTracker {
+	return &swapTracker{
+		names:     map[string]bool{filename: true},
+		lastSwaps: swaps,
+	}
+}
+
+// ended returns true if the episode has ended, given the file mpv is now
+// playing, whether a swap is in progress, the number of swaps so far and the
+// name of the file last swapped to. The swap state must be read after the
+// filename.
+func (t *swapTracker) ended(filename string, swapping bool, swaps int64, swapName string) bool {
+	if swaps != t.lastSwaps {
+		t.lastSwaps = swaps
+		t.names[swapName] = true
+		// mpv may already have loaded the new file
+		t.names[filename] = true
+	}
+
+	return !swapping && !t.names[filename]
+}
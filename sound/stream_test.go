@@ -0,0 +1,56 @@
+package sound
+
+import "testing"
+
+// A waitStep is the state seen by one iteration of Player.Wait.
+type waitStep struct {
+	Filename string
+	Swapping bool
+	Swaps    int64
+	SwapName string
+	Ended    bool
+}
+
+var SwapTests = []struct {
+	Name  string
+	Steps []waitStep
+}{
+	{"no swap", []waitStep{
+		{"ep.mp3", false, 0, "", false},
+		{"ep.mp3", false, 0, "", false},
+		{"next.mp3", false, 0, "", true},
+	}},
+	{"swap in progress", []waitStep{
+		{"feed?id=1", false, 0, "", false},
+		{"ep.mp3", true, 0, "", false},
+		{"ep.mp3", false, 1, "ep.mp3", false},
+		{"ep.mp3", false, 1, "ep.mp3", false},
+		{"next.mp3", false, 1, "ep.mp3", true},
+	}},
+	{"swap finished between checks", []waitStep{
+		{"feed?id=1", false, 0, "", false},
+		{"ep.mp3", false, 1, "ep.mp3", false},
+		{"next.mp3", false, 1, "ep.mp3", true},
+	}},
+	{"file loaded after swap", []waitStep{
+		{"feed?id=1", false, 0, "", false},
+		{"feed?id=1", false, 1, "ep.mp3", false},
+		{"ep.mp3", false, 1, "ep.mp3", false},
+		{"next.mp3", false, 1, "ep.mp3", true},
+	}},
+}
+
+// TestSwapTracker tests that switching from a stream to the downloaded file
+// is not mistaken for the end of the episode.
+func TestSwapTracker(t *testing.T) {
+	for _, elem := range SwapTests {
+		track := newSwapTracker(elem.Steps[0].Filename, 0)
+
+		for i, step := range elem.Steps {
+			ended := track.ended(step.Filename, step.Swapping, step.Swaps, step.SwapName)
+			if ended != step.Ended {
+				t.Errorf("%s: step %d: expected ended %t, got %t", elem.Name, i, step.Ended, ended)
+			}
+		}
+	}
+}
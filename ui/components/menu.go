@@ -17,6 +17,10 @@ type Menu struct {
 	Selected     bool
 	prevw, prevh int
 
+	// Marking highlights the range of items from Mark to the selection
+	Marking bool
+	Mark    int
+
 	List[string]
 }
 
@@ -41,11 +45,19 @@ func (m *Menu) Render() {
 		m.sel = m.H
 	}
 
+	lo, hi := m.MarkedRange()
 	for i, elem := range items {
+		color := int16(0)
 		if c == m.sel && m.Selected {
-			m.Win.ColorOn(colors.BackgroundBlue)
+			color = colors.BackgroundBlue
 		} else if i > m.H {
 			break
+		} else if m.Marking && m.Selected && c >= lo && c <= hi {
+			color = colors.BackgroundYellow
+		}
+
+		if color != 0 {
+			m.Win.ColorOn(color)
 		}
 
 		capped, decode := elem, []rune(elem)
@@ -62,6 +74,22 @@ func (m *Menu) Render() {
 		m.Win.MovePrint(m.Y+i, m.X, capped)
 		c++
 
-		m.Win.ColorOff(colors.BackgroundBlue)
+		if color != 0 {
+			m.Win.ColorOff(color)
+		}
 	}
 }
+
+// MarkedRange returns the first and last index of the range of items from
+// Mark to the selection, in order.
+func (m *Menu) MarkedRange() (lo, hi int) {
+	lo, hi = m.Mark, m.sel
+	if lo > hi {
+		lo, hi = hi, lo
+	}
+	if hi >= len(m.Items) {
+		hi = len(m.Items) - 1
+	}
+
+	return
+}
@@ -0,0 +1,97 @@
+package ui
+
+import (
+	"fmt"
+
+	"github.com/ejv2/podbit/colors"
+	ev "github.com/ejv2/podbit/event"
+	"github.com/ejv2/podbit/sound"
+	"github.com/ejv2/podbit/ui/components"
+)
+
+var deviceHeadings []components.Column = []components.Column{
+	{
+		Label: "",
+		Width: 0.1,
+		Color: colors.BackgroundRed,
+	},
+	{
+		Label: "Device",
+		Width: 0.4,
+		Color: colors.BackgroundBlue,
+	},
+	{
+		Label: "Description",
+		Width: 0.5,
+		Color: colors.BackgroundGreen,
+	},
+}
+
+// Devices is the audio output device picker.
+//
+// Devices displays all output devices reported by the player and
+// allows the user to select which is used for playback.
+type Devices struct {
+	tbl  components.Table
+	devs []sound.AudioDevice
+}
+
+func (d *Devices) Name() string {
+	return "Audio devices"
+}
+
+func (d *Devices) Render(x, y int) {
+	d.tbl.X, d.tbl.Y = x, y
+	d.tbl.W, d.tbl.H = w, h-5
+	d.tbl.Win = root
+
+	d.tbl.Columns = deviceHeadings
+
+	var cur string
+	d.devs, cur = sound.Plr.GetDevices()
+
+	d.tbl.Items = nil
+	for _, elem := range d.devs {
+		item := make([]string, len(deviceHeadings))
+
+		if elem.Name == cur {
+			item[0] = ">>"
+		}
+		item[1] = elem.Name
+		item[2] = elem.Description
+
+		d.tbl.Items = append(d.tbl.Items, item)
+	}
+
+	if len(d.tbl.Items) == 0 {
+		root.MovePrint(y, x, "No audio devices")
+		return
+	}
+
+	d.tbl.Render()
+}
+
+func (d *Devices) Should(event int) bool {
+	return event == ev.Keystroke
+}
+
+func (d *Devices) Input(c rune) {
+	switch c {
+	case 'j':
+		d.tbl.MoveSelection(1)
+	case 'k':
+		d.tbl.MoveSelection(-1)
+	case 'g':
+		d.tbl.ChangeSelection(0)
+	case 'G':
+		d.tbl.ChangeSelection(len(d.tbl.Items) - 1)
+	case 13: // Enter key - Use this device
+		i, _ := d.tbl.GetSelection()
+		if i >= len(d.devs) {
+			return
+		}
+
+		sound.Plr.SetDevice(d.devs[i].Name)
+		go StatusMessage(fmt.Sprintf("Audio output set to %q", d.devs[i].Description))
+	}
+}
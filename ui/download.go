@@ -3,6 +3,8 @@ package ui
 import (
 	"fmt"
 	"strconv"
+	"strings"
+	"time"
 
 	"github.com/ejv2/podbit/colors"
 	"github.com/ejv2/podbit/data"
@@ -14,7 +16,7 @@ import (
 var downloadHeadings []components.Column = []components.Column{
 	{
 		Label: "ID",
-		Width: 0.1,
+		Width: 0.05,
 		Color: colors.BackgroundGreen,
 	},
 	{
@@ -24,89 +26,300 @@ var downloadHeadings []components.Column = []components.Column{
 	},
 	{
 		Label: "Episode",
-		Width: 0.4,
+		Width: 0.3,
 		Color: colors.BackgroundBlue,
 	},
+	{
+		Label: "Size",
+		Width: 0.1,
+		Color: colors.BackgroundMagenta,
+	},
+	{
+		Label: "Speed",
+		Width: 0.1,
+		Color: colors.BackgroundCyan,
+	},
+	{
+		Label: "ETA",
+		Width: 0.1,
+		Color: colors.BackgroundGreen,
+	},
 	{
 		Label: "Status",
-		Width: 0.4,
+		Width: 0.25,
+		Color: colors.BackgroundRed,
+	},
+}
+
+// Columns of the downloads table.
+const (
+	downloadID = iota
+	downloadPercent
+	downloadEpisode
+	downloadSize
+	downloadSpeed
+	downloadETA
+	downloadStatus
+)
+
+var historyHeadings []components.Column = []components.Column{
+	{
+		Label: "Time",
+		Width: 0.15,
+		Color: colors.BackgroundGreen,
+	},
+	{
+		Label: "Episode",
+		Width: 0.35,
+		Color: colors.BackgroundBlue,
+	},
+	{
+		Label: "Size",
+		Width: 0.1,
+		Color: colors.BackgroundMagenta,
+	},
+	{
+		Label: "Took",
+		Width: 0.1,
+		Color: colors.BackgroundCyan,
+	},
+	{
+		Label: "Outcome",
+		Width: 0.3,
 		Color: colors.BackgroundRed,
 	},
 }
 
+// Downloads is the downloads menu, which shows ongoing and recent downloads,
+// or the download log.
 type Downloads struct {
-	tbl components.Table
+	tbl  components.Table
+	hist components.Table
+
+	history bool
 }
 
 func (q *Downloads) Name() string {
+	if q.history {
+		return "Download Log"
+	}
+
 	return "Downloads"
 }
 
 func (q *Downloads) Render(x, y int) {
+	if q.history {
+		q.renderHistory(x, y)
+		return
+	}
+
 	q.tbl.X, q.tbl.Y = x, y
 	q.tbl.W, q.tbl.H = w, h-5
 	q.tbl.Win = root
 
-	q.tbl.Columns = downloadHeadings
+	var total float64
+	now := time.Now()
+	open := data.WindowOpen(now)
 
 	q.tbl.Items = nil
-	for i, elem := range data.Downloads.Downloads() {
+	for _, elem := range data.Downloads.Downloads() {
 		item := make([]string, len(downloadHeadings))
 
-		item[0] = strconv.FormatInt(int64(i), 10)
-		item[1] = strconv.FormatFloat(elem.Percentage*100, 'f', 2, 64)
+		item[downloadID] = strconv.Itoa(elem.ID)
+
+		// Unknown length transfers count bytes instead
+		if elem.Size > 0 || elem.Percentage > 0 {
+			item[downloadPercent] = strconv.FormatFloat(elem.Percentage*100, 'f', 2, 64)
+		} else if elem.Done > 0 {
+			item[downloadPercent] = data.FormatSize(elem.Done)
+		} else {
+			item[downloadPercent] = "-"
+		}
 
 		ep, ok := data.Downloads.Query(elem.Path)
 		if ok {
-			item[2] = ep.Title
+			item[downloadEpisode] = ep.Title
 		} else {
-			item[2] = elem.Path
+			item[downloadEpisode] = elem.Path
+		}
+
+		if elem.Size > 0 {
+			item[downloadSize] = data.FormatSize(elem.Size)
+		}
+
+		running := !elem.Completed && !elem.Queued
+		if running {
+			item[downloadSpeed] = withLimit(elem.Rate, elem.Limit)
+			if eta := elem.ETA(); eta > 0 {
+				item[downloadETA] = eta.String()
+			}
+
+			total += elem.Rate
 		}
 
 		if elem.Completed {
 			if elem.Success {
-				item[3] = "Finished"
+				item[downloadStatus] = "Finished"
+			} else if elem.Attempts > 1 {
+				item[downloadStatus] = fmt.Sprintf("Failed after %d attempts (%s)", elem.Attempts, elem.Error)
 			} else {
-				item[3] = fmt.Sprintf("Failed (%s)", elem.Error)
+				item[downloadStatus] = fmt.Sprintf("Failed (%s)", elem.Error)
 			}
 		} else {
-			if elem.Elem.Youtube && elem.Percentage == 1 {
-				item[3] = "Encoding"
+			if !elem.NextRetry.IsZero() {
+				item[downloadStatus] = retryStatus(elem)
+			} else if elem.Queued && !open && elem.Priority < data.PriorityPlayer {
+				item[downloadStatus] = "Waiting until " + data.NextWindow(now).Format("15:04")
+			} else if elem.Queued {
+				item[downloadStatus] = "Queued"
+			} else if elem.Elem.Youtube && elem.Percentage == 1 {
+				item[downloadStatus] = "Encoding"
 			} else {
-				item[3] = "In progress"
+				item[downloadStatus] = "In progress"
 			}
 		}
 
 		q.tbl.Items = append(q.tbl.Items, item)
 	}
 
+	// Overall rate and limits shown in the status heading
+	q.tbl.Columns = append([]components.Column(nil), downloadHeadings...)
+	status := &q.tbl.Columns[downloadStatus]
+	status.Label = fmt.Sprintf("%s - %s", status.Label, withLimit(total, data.RateLimit))
+	if data.DownloadLimit > 0 {
+		status.Label += fmt.Sprintf(", %s each", data.FormatRate(float64(data.DownloadLimit)))
+	}
+
 	q.tbl.Render()
 }
 
+// withLimit formats a download rate along with the limit on it, if any.
+func withLimit(rate float64, limit int64) string {
+	if limit <= 0 {
+		return data.FormatRate(rate)
+	}
+
+	return data.FormatRate(rate) + " of " + data.FormatRate(float64(limit))
+}
+
+// retryStatus describes a download which is waiting to be retried.
+func retryStatus(dl data.Download) string {
+	wait := time.Until(dl.NextRetry).Round(time.Second)
+	if wait < 0 {
+		wait = 0
+	}
+
+	status := fmt.Sprintf("Retrying in %s (attempt %d of %d", wait, dl.Attempts+1, data.MaxAttempts)
+	if dl.Status != 0 {
+		status += fmt.Sprintf(", HTTP %d", dl.Status)
+	}
+
+	return status + ")"
+}
+
+// renderHistory renders the download log, most recent first.
+func (q *Downloads) renderHistory(x, y int) {
+	q.hist.X, q.hist.Y = x, y
+	q.hist.W, q.hist.H = w, h-5
+	q.hist.Win = root
+	q.hist.Columns = historyHeadings
+
+	hist := data.Downloads.History()
+
+	q.hist.Items = nil
+	for i := len(hist) - 1; i >= 0; i-- {
+		e := hist[i]
+
+		title := e.Path
+		if ep, ok := data.Downloads.Query(e.Path); ok {
+			title = ep.Title
+		}
+
+		outcome := e.Outcome
+		if e.Error != "" && e.Outcome != data.OutcomeCancelled {
+			outcome += " (" + e.Error + ")"
+		}
+
+		q.hist.Items = append(q.hist.Items, []string{
+			e.Time.Format("2006-01-02 15:04"),
+			title,
+			data.FormatSize(e.Bytes),
+			e.Duration.Round(time.Second).String(),
+			outcome,
+		})
+	}
+
+	q.hist.Render()
+}
+
 func (q *Downloads) Should(event int) bool {
 	return event == ev.Keystroke || event == ev.DownloadChanged || event == ev.PlayerChanged
 }
 
 func (q *Downloads) Input(c rune) {
+	tbl := &q.tbl
+	if q.history {
+		tbl = &q.hist
+	}
+
 	switch c {
 	case 'j':
-		q.tbl.MoveSelection(1)
+		tbl.MoveSelection(1)
+		return
 	case 'k':
-		q.tbl.MoveSelection(-1)
+		tbl.MoveSelection(-1)
+		return
 	case 'g':
-		q.tbl.ChangeSelection(0)
+		tbl.ChangeSelection(0)
+		return
 	case 'G':
-		q.tbl.ChangeSelection(len(q.tbl.Items) - 1)
+		tbl.ChangeSelection(len(tbl.Items) - 1)
+		return
+	case 'H':
+		q.history = !q.history
+		return
+	}
+
+	// Remaining keys act on downloads, not the log
+	if q.history {
+		return
+	}
+
+	switch c {
+	case 'C':
+		data.Downloads.ClearCompleted()
+		q.tbl.ChangeSelection(0)
+	case 'F':
+		data.Downloads.ClearFailed()
+		q.tbl.ChangeSelection(0)
 	case 'd':
 		q.Cancel()
+	case 'L':
+		q.Limit()
+	case ' ':
+		q.Resume()
 	case 13:
 		q.Enqueue()
 	}
 }
 
-func (q *Downloads) Enqueue() {
+// selected returns the selected download.
+func (q *Downloads) selected() (data.Download, bool) {
 	i, _ := q.tbl.GetSelection()
-	d := data.Downloads.Downloads()[i].Path
+	dls := data.Downloads.Downloads()
+	if i < 0 || i >= len(dls) {
+		return data.Download{}, false
+	}
+
+	return dls[i], true
+}
+
+func (q *Downloads) Enqueue() {
+	dl, ok := q.selected()
+	if !ok {
+		return
+	}
+	d := dl.Path
 
 	var found *data.QueueItem
 	data.Q.Range(func(i int, item *data.QueueItem) bool {
@@ -120,25 +333,89 @@ func (q *Downloads) Enqueue() {
 
 	if found != nil {
 		go StatusMessage("Enqueued: Download will play once completed")
-		sound.Enqueue(found)
+		editQueue("enqueue", func() {
+			sound.Enqueue(found)
+		})
 	}
 
 	q.tbl.MoveSelection(1)
 }
 
+// Resume restarts the selected failed or cancelled download, continuing
+// from where it left off if possible. A download waiting to be retried is
+// retried immediately.
+func (q *Downloads) Resume() {
+	dl, ok := q.selected()
+	if !ok {
+		return
+	}
+
+	if data.Downloads.RetryNow(dl.ID) {
+		go StatusMessage("Retrying download")
+		return
+	}
+
+	if !dl.Completed || dl.Success {
+		go StatusMessage("Can only resume failed downloads")
+		return
+	}
+
+	dl.Elem.RLock()
+	defer dl.Elem.RUnlock()
+
+	if y, _ := data.Downloads.IsDownloading(dl.Path); y {
+		go StatusMessage("Episode already downloading")
+		return
+	}
+
+	data.Downloads.Download(dl.Elem)
+	go StatusMessage("Download resumed")
+}
+
 func (q *Downloads) Cancel() {
-	i, _ := q.tbl.GetSelection()
-	if i >= len(data.Downloads.Downloads()) {
+	dl, ok := q.selected()
+	if !ok {
 		return
 	}
 
-	dl := data.Downloads.Downloads()[i]
 	if !dl.Completed {
-		go func() {
-			dl.Stop <- 1
-			go StatusMessage("Download cancelled")
-		}()
+		data.Downloads.Cancel(dl.ID)
+		go StatusMessage("Download cancelled")
+		recordCancel(dl.Elem)
 	} else {
 		go StatusMessage("Cannot cancel completed download")
 	}
 }
+
+// Limit asks for a new bandwidth limit for the selected download, in
+// kilobytes per second.
+func (q *Downloads) Limit() {
+	dl, ok := q.selected()
+	if !ok {
+		return
+	}
+
+	if dl.Completed {
+		go StatusMessage("Cannot limit completed download")
+		return
+	}
+
+	PromptDefault("Limit in KB/s (0 for unlimited)", strconv.FormatInt(dl.Limit/1024, 10), func(text string, ok bool) {
+		if !ok {
+			return
+		}
+
+		limit, err := strconv.ParseInt(strings.TrimSpace(text), 10, 64)
+		if err != nil || limit < 0 {
+			go StatusMessage("Invalid limit")
+			return
+		}
+
+		data.Downloads.SetLimit(dl.ID, limit*1024)
+		if limit == 0 {
+			go StatusMessage("Download unlimited")
+		} else {
+			go StatusMessage("Download limited to " + data.FormatRate(float64(limit*1024)))
+		}
+	})
+}
@@ -10,6 +10,9 @@ import (
 	"github.com/ejv2/podbit/sound"
 )
 
+// VolumeStep is the amount the volume changes by for each keypress.
+const VolumeStep = 5
+
 var (
 	exitChan chan struct{}
 )
@@ -36,6 +39,34 @@ func Exit() {
 	close(exitChan)
 }
 
+// expandPlaylist prompts for a YouTube playlist or channel and adds each of
+// its videos to the queue, optionally watching it for new videos.
+func expandPlaylist() {
+	Prompt("Playlist or channel URL", func(url string, ok bool) {
+		if !ok || url == "" {
+			return
+		}
+		if !data.IsURL(url) {
+			go StatusMessage("Error: Not a valid URL")
+			return
+		}
+
+		Confirm("Watch for new videos?", func(watch bool) {
+			go func() {
+				StatusMessage("Listing playlist...")
+
+				added, err := data.ExpandPlaylist(url, watch)
+				if err != nil {
+					StatusMessage(err.Error())
+					return
+				}
+
+				StatusMessage(fmt.Sprintf("Added %d episodes to the queue", added))
+			}()
+		})
+	})
+}
+
 // InputLoop - main UI input handler
 //
 // Receives all key inputs serially, one character at a time
@@ -59,6 +90,11 @@ func InputLoop(exit chan struct{}) {
 				return
 			}
 
+			if handlePrompt(c) {
+				eventsHndl.Post(ev.Keystroke)
+				continue
+			}
+
 			switch c {
 
 			case '1':
@@ -69,6 +105,8 @@ func InputLoop(exit chan struct{}) {
 				ActivateMenu(DownloadMenu)
 			case '4':
 				ActivateMenu(LibraryMenu)
+			case '5':
+				ActivateMenu(PlaylistMenu)
 			case 'r':
 				go func() {
 					reload <- data.DataReload
@@ -84,15 +122,22 @@ func InputLoop(exit chan struct{}) {
 			case 's':
 				sound.Plr.Stop()
 			case 'c':
-				sound.ClearQueue()
+				editQueue("clear queue", sound.ClearQueue)
 			case 'a':
 				pending := data.Q.GetByStatus(data.StatePending)
+				queued := 0
 				for _, elem := range pending {
-					go data.Downloads.Download(elem)
+					elem.RLock()
+					if y, _ := data.Downloads.IsDownloading(elem.Path); !y {
+						data.Downloads.Download(elem)
+						queued++
+					}
+					elem.RUnlock()
 				}
 
-				msg := fmt.Sprintf("Downloading %d episodes in parallel", len(pending))
-				go StatusMessage(msg)
+				go StatusMessage(fmt.Sprintf("Queued %d downloads", queued))
+			case 'y':
+				expandPlaylist()
 			case ']':
 				sound.Plr.Seek(5)
 			case '[':
@@ -101,6 +146,42 @@ func InputLoop(exit chan struct{}) {
 				sound.Plr.Seek(60)
 			case '{':
 				sound.Plr.Seek(-60)
+			case '+', '=':
+				sound.Plr.ChangeVolume(VolumeStep)
+			case '-':
+				sound.Plr.ChangeVolume(-VolumeStep)
+			case 'm':
+				sound.Plr.ToggleMute()
+			case 'o':
+				ActivateMenu(DeviceMenu)
+			case 'z':
+				running := sound.Plr.GetSleep().Mode == sound.SleepTimer
+				sound.Plr.SetSleep(sound.SleepTimer)
+
+				mins := int(sound.SleepStep.Minutes())
+				if running {
+					go StatusMessage(fmt.Sprintf("Sleep timer extended by %d minutes", mins))
+				} else {
+					go StatusMessage(fmt.Sprintf("Sleep timer set for %d minutes", mins))
+				}
+			case 'Z':
+				if sound.Plr.GetSleep().Mode == sound.SleepEpisode {
+					sound.Plr.SetSleep(sound.SleepChapter)
+					go StatusMessage("Sleeping at the end of this chapter")
+				} else {
+					sound.Plr.SetSleep(sound.SleepEpisode)
+					go StatusMessage("Sleeping at the end of this episode")
+				}
+			case 'X':
+				sound.Plr.SetSleep(sound.SleepOff)
+				go StatusMessage("Sleep timer cancelled")
+			case 'M':
+				mode := sound.CycleMode()
+				go StatusMessage(fmt.Sprintf("Playback mode: %s", sound.ModeNames[mode]))
+			case 'u':
+				Undo()
+			case 18: // Control-R
+				Redo()
 			case '\f': // Control-L
 				root.Clear()
 				UpdateDimensions(root)
@@ -79,9 +79,13 @@ func (l *Library) renderEpisodes(x, y int) {
 		} else {
 			text = title
 		}
+		ep.RUnlock()
+
+		if prog := data.Progress(ep); prog > 0 {
+			text += " " + progressBar(prog, ProgressWidth)
+		}
 
 		l.men[1].Items = append(l.men[1].Items, text)
-		ep.RUnlock()
 	}
 
 	l.men[1].Selected = (l.menSel == 1)
@@ -123,7 +127,57 @@ func (l *Library) Input(c rune) {
 		l.StartPlaying(false) // Enter key - enqueue
 	case '\t':
 		l.StartPlaying(true) // Tab key - play NOW!
+	case 'S':
+		l.StreamNow()
+	case 'n':
+		l.PlayNext()
+	case 'w':
+		savePlaylist(l.selectedItems())
+	case 'v':
+		l.ToggleMarking()
+	case 27: // Escape key
+		l.men[1].Marking = false
+	case 'U':
+		l.MarkState(data.StatePending, "unplayed")
+	case 'P':
+		l.MarkState(data.StatePlayed, "played")
+	case 'F':
+		l.MarkState(data.StateFinished, "finished")
+	case '0':
+		l.ResetResume()
+	case 'D':
+		l.DeleteFiles()
+	}
+}
+
+// selectedItems returns the focused episode, the marked episodes if marking,
+// or, if a podcast is focused, all of its episodes.
+func (l *Library) selectedItems() []*data.QueueItem {
+	if len(l.men[0].Items) < 1 || len(l.men[1].Items) < 1 {
+		return nil
+	}
+
+	_, pod := l.men[0].GetSelection()
+	eps := data.Q.GetPodcastEpisodes(pod)
+
+	// Displayed newest first
+	lo, hi := 0, len(l.men[1].Items)-1
+	if l.menSel == 1 {
+		lo, _ = l.men[1].GetSelection()
+		hi = lo
+		if l.men[1].Marking {
+			lo, hi = l.men[1].MarkedRange()
+		}
+	}
+
+	items := make([]*data.QueueItem, 0, hi-lo+1)
+	for i := lo; i <= hi; i++ {
+		if j := len(eps) - 1 - i; j >= 0 && j < len(eps) {
+			items = append(items, eps[j])
+		}
 	}
+
+	return items
 }
 
 func (l *Library) ChangeSelection(index int) {
@@ -135,6 +189,7 @@ func (l *Library) ChangeSelection(index int) {
 
 	if l.menSel == 0 {
 		l.men[1].ChangeSelection(0)
+		l.men[1].Marking = false
 	}
 }
 
@@ -158,14 +213,9 @@ func (l *Library) StartDownload() {
 		l.men[l.menSel].MoveSelection(1)
 	}()
 
-	targets := l.men[1].Items
-	if l.menSel == 1 {
-		_, target := l.men[1].GetSelection()
-		item := data.Q.GetEpisodeByURL(target)
-
-		if item == nil {
-			return
-		}
+	targets := l.selectedItems()
+	if l.menSel == 1 && len(targets) == 1 {
+		item := targets[0]
 
 		item.RLock()
 		defer item.RUnlock()
@@ -180,25 +230,24 @@ func (l *Library) StartDownload() {
 		return
 	}
 
-	for _, elem := range targets {
-		if data.IsURL(elem) {
-			item := data.Q.GetEpisodeByURL(elem)
-			if item == nil {
-				continue
-			}
-
-			item.RLock()
-			if y, _ := data.Downloads.IsDownloading(item.Path); y {
-				go StatusMessage("Episode already downloading")
-				return
-			}
-			item.RUnlock()
+	queued := 0
+	for _, item := range targets {
+		// Skip episodes which are already downloaded
+		if _, ok := data.Downloads.Query(item.Path); ok {
+			continue
+		}
 
-			go data.Downloads.Download(item)
+		// Queued in list order, so they download in that order
+		item.RLock()
+		if y, _ := data.Downloads.IsDownloading(item.Path); !y {
+			data.Downloads.Download(item)
+			queued++
 		}
+		item.RUnlock()
 	}
+	l.men[1].Marking = false
 
-	go StatusMessage("Download of multiple episodes started...")
+	go StatusMessage(fmt.Sprintf("Queued %d downloads", queued))
 }
 
 // StartPlaying begins playing the currently focused element.
@@ -215,20 +264,24 @@ func (l *Library) StartPlaying(immediate bool) {
 	}()
 
 	if l.menSel == 1 {
-		var item *data.QueueItem
-		_, entry := l.men[1].GetSelection()
-		if data.IsURL(entry) {
-			item = data.Q.GetEpisodeByURL(entry)
-		} else {
-			item = data.Q.GetEpisodeByTitle(entry)
+		items := l.selectedItems()
+		if len(items) == 0 {
+			return
 		}
 
+		item := items[0]
+		entry := episodeTitle(item.URL)
+
 		if immediate {
 			go StatusMessage(fmt.Sprintf("Now playing episode %q", entry))
-			sound.PlayNow(item)
+			editQueue("play now", func() {
+				sound.PlayNow(item)
+			})
 		} else {
 			go StatusMessage(fmt.Sprintf("Enqueued episode %q to play", entry))
-			sound.Enqueue(item)
+			editQueue("enqueue", func() {
+				sound.Enqueue(item)
+			})
 		}
 
 	} else {
@@ -237,7 +290,162 @@ func (l *Library) StartPlaying(immediate bool) {
 		}
 
 		_, entry := l.men[0].GetSelection()
-		sound.EnqueueByPodcast(entry)
+		editQueue("enqueue podcast", func() {
+			sound.EnqueueByPodcast(entry)
+		})
 		go StatusMessage("Multiple episodes enqueued...")
 	}
 }
+
+// PlayNext enqueues the focused episode to play directly after the
+// currently playing episode.
+func (l *Library) PlayNext() {
+	if l.menSel != 1 {
+		return
+	}
+
+	items := l.selectedItems()
+	if len(items) == 0 {
+		return
+	}
+
+	editQueue("play next", func() {
+		sound.PlayNext(items[0])
+	})
+	go StatusMessage("Episode will play next")
+}
+
+// StreamNow starts playing the focused episode immediately, streaming it
+// while it downloads if it is not yet downloaded.
+func (l *Library) StreamNow() {
+	if l.menSel != 1 {
+		return
+	}
+
+	items := l.selectedItems()
+	if len(items) == 0 {
+		return
+	}
+
+	if items[0].Youtube {
+		go StatusMessage("Error: YouTube episodes cannot be streamed")
+		return
+	}
+
+	editQueue("stream now", func() {
+		sound.StreamNow(items[0])
+	})
+	go StatusMessage("Streaming episode")
+}
+
+// ToggleMarking starts or stops marking a range of episodes, starting from
+// the focused episode. Actions on episodes then apply to the whole range.
+func (l *Library) ToggleMarking() {
+	if l.menSel != 1 {
+		return
+	}
+
+	l.men[1].Mark, _ = l.men[1].GetSelection()
+	l.men[1].Marking = !l.men[1].Marking
+}
+
+// MarkState sets the state of the selected episodes, described by desc.
+func (l *Library) MarkState(state int, desc string) {
+	items := l.selectedItems()
+	if len(items) == 0 {
+		return
+	}
+	l.men[1].Marking = false
+
+	prev := make([]int, len(items))
+	for i, item := range items {
+		item.RLock()
+		prev[i] = item.State
+		item.RUnlock()
+	}
+
+	mark := func() {
+		for _, item := range items {
+			data.MarkState(item, state)
+		}
+		data.Q.Save()
+	}
+	mark()
+
+	msg := fmt.Sprintf("%d episodes marked as %s", len(items), desc)
+	recordUndo(msg, func() {
+		for i, item := range items {
+			item.Lock()
+			item.State = prev[i]
+			item.Unlock()
+		}
+		data.Q.Save()
+	}, mark)
+
+	go StatusMessage(msg)
+}
+
+// ResetResume resets the resume position of the selected episodes, so that
+// they play from the beginning.
+func (l *Library) ResetResume() {
+	items := l.selectedItems()
+	if len(items) == 0 {
+		return
+	}
+	l.men[1].Marking = false
+
+	prev := make([]uint64, len(items))
+	for i, item := range items {
+		if _, res, err := data.Stamps.Stat(item.Path); err == nil {
+			prev[i] = *res
+		}
+	}
+
+	reset := func() {
+		for _, item := range items {
+			data.ResetResume(item)
+		}
+	}
+	reset()
+
+	msg := fmt.Sprintf("Resume position of %d episodes reset", len(items))
+	recordUndo(msg, func() {
+		for i, item := range items {
+			data.Stamps.SetResume(item.Path, prev[i])
+		}
+	}, reset)
+
+	go StatusMessage(msg)
+}
+
+// DeleteFiles deletes the downloaded files of the selected episodes after
+// confirmation, so that they must be downloaded again to be played. The
+// episode currently playing is not deleted.
+func (l *Library) DeleteFiles() {
+	items := l.selectedItems()
+	if len(items) == 0 {
+		return
+	}
+	l.men[1].Marking = false
+
+	Confirm(fmt.Sprintf("Delete the files of %d episodes?", len(items)), func(yes bool) {
+		if !yes {
+			return
+		}
+
+		playing := sound.Plr.IsPlaying()
+		count := 0
+		for _, item := range items {
+			if playing && item == sound.Plr.Now {
+				continue
+			}
+
+			if data.DeleteEpisode(item) == nil {
+				count++
+			}
+		}
+		data.Q.Save()
+
+		go StatusMessage(fmt.Sprintf("Deleted the files of %d episodes", count))
+	})
+}
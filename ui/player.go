@@ -1,7 +1,9 @@
 package ui
 
 import (
+	"fmt"
 	"math"
+	"strings"
 
 	"github.com/ejv2/podbit/colors"
 	"github.com/ejv2/podbit/data"
@@ -61,6 +63,20 @@ func (l *Player) Render(x, y int) {
 	root.MovePrint(x+10, minxp, pod)
 	root.ColorOff(colors.ColorGreen)
 
+	// Audio filters
+	chain := sound.Plr.GetFilters()
+	ftxt := "Filters: none"
+	if len(chain) > 0 {
+		ftxt = "Filters: " + strings.Join(chain, ", ")
+	}
+	if saved := sound.Plr.GetSaved(); sound.Plr.IsPlaying() && saved > 0 {
+		ftxt += fmt.Sprintf(" (%s of silence skipped)", data.FormatTime(saved))
+	}
+	ftxt = data.LimitString(ftxt, w-1)
+	root.ColorOn(colors.ColorMagenta)
+	root.MovePrint(x+12, (w-len(ftxt))/2, ftxt)
+	root.ColorOff(colors.ColorMagenta)
+
 	root.MovePrint(h-(h/3), 0, p)
 	root.MovePrint(h-(h/3), w-len(d), d)
 
@@ -111,5 +127,34 @@ func (l *Player) Input(c rune) {
 		sound.Plr.Seek(-60)
 	case 'L':
 		sound.Plr.Seek(60)
+
+	case 'n':
+		l.cycleNormalisation()
+	case 'x':
+		sound.Plr.ToggleFilter(sound.FilterSilence)
+	case 'e':
+		sound.Plr.ToggleFilter(sound.FilterEQ)
+	}
+}
+
+// cycleNormalisation cycles the loudness normalisation filter between none,
+// loudnorm and dynaudnorm.
+func (l *Player) cycleNormalisation() {
+	var loud, dyn bool
+	for _, f := range sound.Plr.GetFilters() {
+		loud = loud || f == sound.FilterLoudnorm
+		dyn = dyn || f == sound.FilterDynaudnorm
+	}
+
+	switch {
+	case loud:
+		sound.Plr.ToggleFilter(sound.FilterDynaudnorm)
+		go StatusMessage("Normalisation: dynaudnorm")
+	case dyn:
+		sound.Plr.ToggleFilter(sound.FilterDynaudnorm)
+		go StatusMessage("Normalisation: off")
+	default:
+		sound.Plr.ToggleFilter(sound.FilterLoudnorm)
+		go StatusMessage("Normalisation: loudnorm")
 	}
 }
@@ -0,0 +1,392 @@
+package ui
+
+import (
+	"fmt"
+
+	"github.com/ejv2/podbit/data"
+	ev "github.com/ejv2/podbit/event"
+	"github.com/ejv2/podbit/sound"
+	"github.com/ejv2/podbit/ui/components"
+
+	goncurses "github.com/vit1251/go-ncursesw"
+)
+
+// Playlists is the menu of named playlists saved to disk.
+//
+// Playlists displays each saved playlist, along with the episodes in the
+// selected playlist, and allows playlists to be loaded into the play queue
+// or edited.
+type Playlists struct {
+	men [2]components.Menu
+
+	menSel int
+}
+
+// episodeTitle returns the name to display for an episode: the title, if
+// known, otherwise the URL.
+func episodeTitle(url string) string {
+	item := data.Q.GetEpisodeByURL(url)
+	if item == nil {
+		return url
+	}
+
+	if ep, ok := data.Downloads.Query(item.Path); ok && ep.Title != "" {
+		return ep.Title
+	}
+
+	return url
+}
+
+func (p *Playlists) Name() string {
+	return "Playlists"
+}
+
+func (p *Playlists) renderPlaylists(x, y int) {
+	p.men[0].X = x
+	p.men[0].Y = y
+
+	p.men[0].W, p.men[0].H = (w/2)-1, (h - 5)
+	p.men[0].Win = *root
+
+	p.men[0].Items = data.GetPlaylists()
+	p.men[0].Selected = true
+
+	if len(p.men[0].Items) > 0 {
+		p.men[0].Render()
+	} else {
+		root.MovePrint(y, x, "No playlists")
+	}
+}
+
+func (p *Playlists) renderEpisodes(x, y int) {
+	p.men[1].Items = p.men[1].Items[:0]
+	if len(p.men[0].Items) < 1 {
+		return
+	}
+
+	p.men[1].X = x
+	p.men[1].Y = y
+
+	p.men[1].W, p.men[1].H = (w/2)-2, (h - 5)
+	p.men[1].Win = *root
+
+	_, name := p.men[0].GetSelection()
+	pl, err := data.LoadPlaylist(name)
+	if err != nil {
+		root.MovePrint(y, x, "Error reading playlist")
+		return
+	}
+
+	for _, url := range pl.URLs {
+		p.men[1].Items = append(p.men[1].Items, episodeTitle(url))
+	}
+
+	p.men[1].Selected = (p.menSel == 1)
+
+	if len(p.men[1].Items) > 0 {
+		p.men[1].Render()
+	} else {
+		root.MovePrint(y, x, "Empty playlist")
+	}
+}
+
+func (p *Playlists) Render(x, y int) {
+	p.renderPlaylists(x, y)
+
+	root.AttrOn(goncurses.A_BOLD)
+	root.VLine(y, w/2, goncurses.ACS_VLINE, h-2-y)
+	root.AttrOff(goncurses.A_BOLD)
+
+	p.renderEpisodes(w/2+1, y)
+}
+
+func (p *Playlists) Should(event int) bool {
+	return event == ev.Keystroke
+}
+
+func (p *Playlists) Input(c rune) {
+	switch c {
+	case 'j':
+		p.men[p.menSel].MoveSelection(1)
+	case 'k':
+		p.men[p.menSel].MoveSelection(-1)
+	case 'h':
+		p.MoveSelection(-1)
+	case 'l':
+		p.MoveSelection(1)
+	case 'g':
+		p.men[p.menSel].ChangeSelection(0)
+	case 'G':
+		p.men[p.menSel].ChangeSelection(len(p.men[p.menSel].Items) - 1)
+	case 'J':
+		p.MoveEpisode(1)
+	case 'K':
+		p.MoveEpisode(-1)
+	case 13:
+		p.Load(false) // Enter key - append to queue
+	case '\t':
+		p.Load(true) // Tab key - replace queue
+	case 'n':
+		p.Rename()
+	case 'd':
+		p.Delete()
+	case 'N':
+		p.NewSmart()
+	case 'e':
+		p.EditQuery()
+	}
+}
+
+func (p *Playlists) ChangeSelection(index int) {
+	if index >= len(p.men) || index < 0 {
+		return
+	}
+	if index == 1 && len(p.men[1].Items) < 1 {
+		return
+	}
+
+	p.menSel = index
+
+	if p.menSel == 0 {
+		p.men[1].ChangeSelection(0)
+	}
+}
+
+func (p *Playlists) MoveSelection(direction int) {
+	if direction == 0 {
+		return
+	}
+
+	off := p.menSel + direction
+	p.ChangeSelection(off)
+}
+
+// selected returns the selected playlist.
+func (p *Playlists) selected() (data.Playlist, bool) {
+	if len(p.men[0].Items) < 1 {
+		return data.Playlist{}, false
+	}
+
+	_, name := p.men[0].GetSelection()
+	pl, err := data.LoadPlaylist(name)
+	if err != nil {
+		go StatusMessage(fmt.Sprintf("Error reading playlist %q: %s", name, err))
+		return pl, false
+	}
+
+	return pl, true
+}
+
+// Load loads the selected playlist into the play queue. If replace is true,
+// the play queue is replaced by the playlist, otherwise the playlist is
+// appended. If an episode is selected, only that episode is enqueued.
+func (p *Playlists) Load(replace bool) {
+	pl, ok := p.selected()
+	if !ok {
+		return
+	}
+
+	if p.menSel == 1 {
+		i, _ := p.men[1].GetSelection()
+		if i >= len(pl.URLs) {
+			return
+		}
+
+		url := pl.URLs[i]
+		editQueue("enqueue", func() {
+			sound.EnqueueByURL(url)
+		})
+		go StatusMessage("Episode enqueued")
+		return
+	}
+
+	items := pl.Items()
+	if replace {
+		editQueue("replace queue", func() {
+			sound.ReplaceQueue(items)
+		})
+		go StatusMessage(fmt.Sprintf("Queue replaced by playlist %q", pl.Name))
+	} else {
+		editQueue("enqueue playlist", func() {
+			sound.EnqueueAll(items)
+		})
+		go StatusMessage(fmt.Sprintf("Enqueued %d episodes from playlist %q", len(items), pl.Name))
+	}
+}
+
+// Rename prompts for a new name for the selected playlist.
+func (p *Playlists) Rename() {
+	if p.menSel != 0 || len(p.men[0].Items) < 1 {
+		return
+	}
+
+	_, name := p.men[0].GetSelection()
+	Prompt(fmt.Sprintf("Rename playlist %q to", name), func(to string, ok bool) {
+		if !ok || to == "" {
+			return
+		}
+
+		if err := data.RenamePlaylist(name, to); err != nil {
+			go StatusMessage(fmt.Sprintf("Error renaming playlist: %s", err))
+			return
+		}
+
+		go StatusMessage(fmt.Sprintf("Playlist renamed to %q", to))
+	})
+}
+
+// Delete deletes the selected playlist after confirmation or, if an episode
+// is selected, removes that episode from the playlist.
+func (p *Playlists) Delete() {
+	pl, ok := p.selected()
+	if !ok {
+		return
+	}
+
+	if p.menSel == 1 {
+		i, _ := p.men[1].GetSelection()
+		if i >= len(pl.URLs) {
+			return
+		}
+		if pl.Query != "" {
+			go StatusMessage(data.ErrorPlaylistSmart.Error())
+			return
+		}
+
+		pl.URLs = append(pl.URLs[:i], pl.URLs[i+1:]...)
+		pl.Save()
+		if len(pl.URLs) == 0 {
+			p.ChangeSelection(0)
+		}
+
+		return
+	}
+
+	Confirm(fmt.Sprintf("Delete playlist %q?", pl.Name), func(yes bool) {
+		if !yes {
+			return
+		}
+
+		if err := data.DeletePlaylist(pl.Name); err != nil {
+			go StatusMessage(fmt.Sprintf("Error deleting playlist: %s", err))
+			return
+		}
+
+		go StatusMessage(fmt.Sprintf("Playlist %q deleted", pl.Name))
+	})
+}
+
+// MoveEpisode moves the selected episode within its playlist by off places.
+func (p *Playlists) MoveEpisode(off int) {
+	if p.menSel != 1 {
+		return
+	}
+
+	pl, ok := p.selected()
+	if !ok {
+		return
+	}
+	if pl.Query != "" {
+		go StatusMessage(data.ErrorPlaylistSmart.Error())
+		return
+	}
+
+	i, _ := p.men[1].GetSelection()
+	j := i + off
+	if i >= len(pl.URLs) || j < 0 || j >= len(pl.URLs) {
+		return
+	}
+
+	pl.URLs[i], pl.URLs[j] = pl.URLs[j], pl.URLs[i]
+	pl.Save()
+
+	p.men[1].ChangeSelection(j)
+}
+
+// saveQuery validates a smart playlist query before saving it.
+func saveQuery(name, query string) {
+	q, err := data.ParseQuery(query)
+	if err != nil {
+		go StatusMessage(err.Error())
+		return
+	}
+
+	pl := data.Playlist{Name: name, Query: query}
+	if err := pl.Save(); err != nil {
+		go StatusMessage(fmt.Sprintf("Error saving playlist: %s", err))
+		return
+	}
+	data.RefreshPlaylists()
+
+	go StatusMessage(fmt.Sprintf("Smart playlist %q matches %d episodes", name, len(data.EvaluateQuery(q))))
+}
+
+// NewSmart prompts for the name and query of a new smart playlist.
+func (p *Playlists) NewSmart() {
+	Prompt("New smart playlist name", func(name string, ok bool) {
+		if !ok || name == "" {
+			return
+		}
+
+		ask := func() {
+			Prompt("Query", func(query string, ok bool) {
+				if ok {
+					saveQuery(name, query)
+				}
+			})
+		}
+
+		// Saving replaces any playlist of the same name
+		for _, elem := range data.GetPlaylists() {
+			if elem == name {
+				Confirm(fmt.Sprintf("Replace existing playlist %q?", name), func(yes bool) {
+					if yes {
+						ask()
+					}
+				})
+				return
+			}
+		}
+
+		ask()
+	})
+}
+
+// EditQuery prompts for a new query for the selected smart playlist.
+func (p *Playlists) EditQuery() {
+	pl, ok := p.selected()
+	if !ok {
+		return
+	}
+	if pl.Query == "" {
+		go StatusMessage("Not a smart playlist")
+		return
+	}
+
+	PromptDefault("Query", pl.Query, func(query string, ok bool) {
+		if ok {
+			saveQuery(pl.Name, query)
+		}
+	})
+}
+
+// savePlaylist prompts for the name of a playlist to which items are
+// appended.
+func savePlaylist(items []*data.QueueItem) {
+	if len(items) == 0 {
+		return
+	}
+
+	Prompt("Add to playlist", func(name string, ok bool) {
+		if !ok || name == "" {
+			return
+		}
+
+		if err := data.AppendPlaylist(name, items); err != nil {
+			go StatusMessage(fmt.Sprintf("Error saving playlist: %s", err))
+			return
+		}
+
+		go StatusMessage(fmt.Sprintf("Added %d episodes to playlist %q", len(items), name))
+	})
+}
@@ -0,0 +1,139 @@
+package ui
+
+import (
+	"sync"
+
+	"github.com/ejv2/podbit/colors"
+
+	goncurses "github.com/vit1251/go-ncursesw"
+)
+
+// A prompt is a question asked of the user in the tray. While a prompt is
+// active, it takes over all keyboard input until it is answered.
+type prompt struct {
+	question string
+	text     []rune
+
+	// confirm is true for yes/no questions rather than text input
+	confirm  bool
+	callback func(answer string, ok bool)
+}
+
+var (
+	promptMut sync.Mutex
+	active    *prompt
+)
+
+// Confirm asks the user a yes or no question in the tray. Once answered, the
+// callback is called on the input thread with the answer.
+//
+// If another prompt is already active, it is replaced.
+func Confirm(question string, callback func(yes bool)) {
+	promptMut.Lock()
+	defer promptMut.Unlock()
+
+	active = &prompt{
+		question: question + " [y/n] ",
+		confirm:  true,
+		callback: func(_ string, ok bool) {
+			callback(ok)
+		},
+	}
+}
+
+// Prompt asks the user for a line of text in the tray. Once entered, the
+// callback is called on the input thread with the text. If the user
+// cancelled the prompt, ok is false.
+//
+// If another prompt is already active, it is replaced.
+func Prompt(question string, callback func(text string, ok bool)) {
+	PromptDefault(question, "", callback)
+}
+
+// PromptDefault is like Prompt, except that the text starts out as initial
+// rather than empty.
+func PromptDefault(question, initial string, callback func(text string, ok bool)) {
+	promptMut.Lock()
+	defer promptMut.Unlock()
+
+	active = &prompt{
+		question: question + ": ",
+		text:     []rune(initial),
+		callback: callback,
+	}
+}
+
+// handlePrompt passes a keystroke to the active prompt. Returns false if no
+// prompt is active, in which case the keystroke should be handled normally.
+func handlePrompt(c rune) bool {
+	promptMut.Lock()
+	p := active
+	if p == nil {
+		promptMut.Unlock()
+		return false
+	}
+
+	var done, ok bool
+	if p.confirm {
+		switch c {
+		case 'y', 'Y':
+			done, ok = true, true
+		case 'n', 'N', 27: // Escape key
+			done, ok = true, false
+		}
+	} else {
+		switch c {
+		case 13: // Enter key
+			done, ok = true, true
+		case 27: // Escape key
+			done, ok = true, false
+		case 127, '\b':
+			if len(p.text) > 0 {
+				p.text = p.text[:len(p.text)-1]
+			}
+		default:
+			if c >= ' ' {
+				p.text = append(p.text, c)
+			}
+		}
+	}
+
+	if done {
+		active = nil
+	}
+	promptMut.Unlock()
+
+	// Called without lock held so the callback may prompt again
+	if done {
+		p.callback(string(p.text), ok)
+	}
+
+	return true
+}
+
+// renderPrompt renders the active prompt to the status line of the tray.
+// Returns false if there was no prompt to render.
+func renderPrompt(scr *goncurses.Window, w, h int) bool {
+	promptMut.Lock()
+	defer promptMut.Unlock()
+
+	if active == nil {
+		return false
+	}
+
+	scr.ColorOn(colors.ColorGreen)
+	scr.AttrOn(goncurses.A_BOLD)
+	scr.MovePrint(h-1, 0, active.question)
+	scr.AttrOff(goncurses.A_BOLD)
+	scr.ColorOff(colors.ColorGreen)
+
+	// Keep the end of the text visible
+	text := active.text
+	room := w - len([]rune(active.question)) - 1
+	if room > 0 && len(text) > room {
+		text = text[len(text)-room:]
+	}
+	scr.Print(string(text))
+
+	return true
+}
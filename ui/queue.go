@@ -16,14 +16,19 @@ var queueHeadings []components.Column = []components.Column{
 	},
 	{
 		Label: "Name",
-		Width: 0.5,
+		Width: 0.4,
 		Color: colors.BackgroundBlue,
 	},
 	{
 		Label: "Podcast",
-		Width: 0.4,
+		Width: 0.3,
 		Color: colors.BackgroundGreen,
 	},
+	{
+		Label: "Progress",
+		Width: 0.2,
+		Color: colors.BackgroundYellow,
+	},
 }
 
 // Queue displays the current play queue.
@@ -55,15 +60,28 @@ func (q *Queue) Render(x, y int) {
 			item[1] = dat.Title
 		}
 
+		if sound.IsPrefetched(elem) {
+			// Downloaded ahead of time
+			item[0] += "P"
+		}
+
 		if !ok {
-			// In need of download
-			item[0] += "!!"
+			if y, _ := data.Downloads.IsDownloading(elem.Path); y {
+				// Download in progress
+				item[0] += ".."
+			} else {
+				// In need of download
+				item[0] += "!!"
+			}
 		} else if sound.Plr.NowPlaying == item[1] {
 			// Currently playing
 			item[0] += ">>"
 		}
 
 		item[2] = pod
+		if prog := data.Progress(elem); prog > 0 {
+			item[3] = progressBar(prog, ProgressWidth)
+		}
 
 		q.tbl.Items = append(q.tbl.Items, item)
 	}
@@ -86,10 +104,57 @@ func (q *Queue) Input(c rune) {
 	case 'G':
 		q.tbl.ChangeSelection(len(q.tbl.Items) - 1)
 	case 'd':
+		if len(q.tbl.Items) < 1 {
+			return
+		}
+
+		// Redo finds the item again, in case the queue has since moved
 		i, _ := q.tbl.GetSelection()
-		sound.Dequeue(i)
+		queue := sound.GetQueue()
+		if i >= len(queue) {
+			return
+		}
+
+		item := queue[i]
+		editQueue("dequeue", func() {
+			sound.Dequeue(sound.IndexOf(item, i))
+		})
 	case 13: // Enter key - Jump to this position
 		i, _ := q.tbl.GetSelection()
 		sound.JumpTo(i)
+	case 'J':
+		q.moveSelected(sound.MoveDown)
+	case 'K':
+		q.moveSelected(sound.MoveUp)
+	case 'T':
+		q.moveSelected(sound.MoveToTop)
+	case 'B':
+		q.moveSelected(sound.MoveToBottom)
+	case 'w':
+		savePlaylist(sound.GetQueue())
+	}
+}
+
+// moveSelected moves the selected item using the move function and keeps
+// the selection on the moved item.
+func (q *Queue) moveSelected(move func(int) int) {
+	if len(q.tbl.Items) < 1 {
+		return
+	}
+
+	i, _ := q.tbl.GetSelection()
+	queue := sound.GetQueue()
+	if i >= len(queue) {
+		return
+	}
+
+	item := queue[i]
+	n := i
+	editQueue("move", func() {
+		n = move(sound.IndexOf(item, i))
+	})
+
+	if n >= 0 {
+		q.tbl.ChangeSelection(n)
 	}
 }
@@ -42,6 +42,11 @@ func RenderTray(scr *goncurses.Window, w, h int) {
 	scr.MovePrint(h-2, head, ">")
 	scr.ColorOff(colors.ColorBlue)
 
+	// Prompts take over the whole status line
+	if renderPrompt(scr, w, h) {
+		return
+	}
+
 	now := time.Now()
 	if now.Sub(lastStatus) > MessageTime {
 		select {
@@ -67,6 +72,8 @@ func RenderTray(scr *goncurses.Window, w, h int) {
 			var status string
 			if sound.Plr.IsPaused() {
 				status = "Paused"
+			} else if sound.Plr.IsStreaming() {
+				status = "Streaming"
 			} else {
 				status = "Playing"
 			}
@@ -97,6 +104,44 @@ func RenderTray(scr *goncurses.Window, w, h int) {
 	root.ColorOn(colors.ColorRed)
 	scr.MovePrintf(h-1, w-len(code), "%s", code)
 	root.ColorOff(colors.ColorRed)
+
+	// Volume tray
+	vol, muted := sound.Plr.GetVolume()
+	volcode := fmt.Sprintf("[vol: %d%%] ", vol)
+	if muted {
+		volcode = "[muted] "
+	}
+	root.ColorOn(colors.ColorYellow)
+	scr.MovePrint(h-1, w-len(code)-len(volcode), volcode)
+	root.ColorOff(colors.ColorYellow)
+
+	// Sleep timer tray
+	var sleepcode string
+	sleep := sound.Plr.GetSleep()
+	if sleep.Mode != sound.SleepOff {
+		switch sleep.Mode {
+		case sound.SleepEpisode:
+			sleepcode = "[sleep: ep "
+		case sound.SleepChapter:
+			sleepcode = "[sleep: ch "
+		default:
+			sleepcode = "[sleep: "
+		}
+		sleepcode += data.FormatTime(math.Max(sleep.Remaining.Seconds(), 0)) + "] "
+
+		root.ColorOn(colors.ColorMagenta)
+		scr.MovePrint(h-1, w-len(code)-len(volcode)-len(sleepcode), sleepcode)
+		root.ColorOff(colors.ColorMagenta)
+	}
+
+	// Playback mode tray
+	if mode := sound.GetMode(); mode != sound.ModeNormal {
+		modecode := fmt.Sprintf("[%s] ", sound.ModeNames[mode])
+
+		root.ColorOn(colors.ColorGreen)
+		scr.MovePrint(h-1, w-len(code)-len(volcode)-len(sleepcode)-len(modecode), modecode)
+		root.ColorOff(colors.ColorGreen)
+	}
 }
 
 // StatusMessage sends a status message to the tray.
@@ -23,8 +23,10 @@
 package ui
 
 import (
+	"fmt"
 	"os"
 	"os/signal"
+	"strings"
 	"syscall"
 
 	ev "github.com/ejv2/podbit/event"
@@ -61,8 +63,14 @@ var (
 	QueueMenu    = new(Queue)     // Player queue display.
 	DownloadMenu = new(Downloads) // Shows ongoing downloads.
 	LibraryMenu  = new(Library)   // Library of podcasts and episodes.
+	PlaylistMenu = new(Playlists) // Named playlists saved to disk.
+	DeviceMenu   = new(Devices)   // Audio output device picker.
 )
 
+// ProgressWidth is the width of the bar drawn inside of progress bars for
+// listening progress.
+const ProgressWidth = 10
+
 // Watch the terminal for resizes and redraw when needed.
 func watchResize(sig chan os.Signal, scr *goncurses.Window) {
 	for {
@@ -108,6 +116,17 @@ func UpdateDimensions(scr *goncurses.Window) {
 	goncurses.ResizeTerm(h, w)
 }
 
+// progressBar returns a textual progress bar of the given width followed by
+// the percentage, for progress from zero to one.
+func progressBar(progress float64, width int) string {
+	filled := int(progress * float64(width))
+	if filled > width {
+		filled = width
+	}
+
+	return "[" + strings.Repeat("=", filled) + strings.Repeat(" ", width-filled) + "] " + fmt.Sprintf("%3.0f%%", progress*100)
+}
+
 func renderMenu() {
 	if currentMenu == nil {
 		return
@@ -0,0 +1,155 @@
+package ui
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/ejv2/podbit/data"
+	"github.com/ejv2/podbit/sound"
+)
+
+// MaxUndo is the maximum number of actions which are remembered for undoing.
+const MaxUndo = 100
+
+// An undoable is an action which has been performed and can be reversed by
+// undo, then performed again by redo.
+type undoable struct {
+	desc string
+	undo func()
+	redo func()
+}
+
+// Undo history.
+var (
+	undoMut   sync.Mutex
+	undoStack []undoable
+	redoStack []undoable
+)
+
+// recordUndo records an action which has just been performed so that it may
+// be undone. Any undone actions can no longer be redone.
+func recordUndo(desc string, undo, redo func()) {
+	undoMut.Lock()
+	defer undoMut.Unlock()
+
+	undoStack = append(undoStack, undoable{desc, undo, redo})
+	if len(undoStack) > MaxUndo {
+		undoStack = undoStack[len(undoStack)-MaxUndo:]
+	}
+	redoStack = redoStack[:0]
+}
+
+// Undo reverses the last action recorded, reporting it in the tray.
+func Undo() {
+	undoMut.Lock()
+	if len(undoStack) == 0 {
+		undoMut.Unlock()
+		go StatusMessage("Nothing to undo")
+		return
+	}
+
+	act := undoStack[len(undoStack)-1]
+	undoStack = undoStack[:len(undoStack)-1]
+	redoStack = append(redoStack, act)
+	undoMut.Unlock()
+
+	act.undo()
+	go StatusMessage(fmt.Sprintf("Undone: %s", act.desc))
+}
+
+// Redo performs the last undone action again, reporting it in the tray.
+func Redo() {
+	undoMut.Lock()
+	if len(redoStack) == 0 {
+		undoMut.Unlock()
+		go StatusMessage("Nothing to redo")
+		return
+	}
+
+	act := redoStack[len(redoStack)-1]
+	redoStack = redoStack[:len(redoStack)-1]
+	undoStack = append(undoStack, act)
+	undoMut.Unlock()
+
+	act.redo()
+	go StatusMessage(fmt.Sprintf("Redone: %s", act.desc))
+}
+
+// queueSnapshot is the state of the play queue before or after an edit.
+type queueSnapshot struct {
+	state   sound.QueueState
+	playing bool
+}
+
+func takeSnapshot() queueSnapshot {
+	return queueSnapshot{sound.GetQueueState(), sound.Plr.IsPlaying()}
+}
+
+// restoreSnapshot restores the play queue to a snapshot. If an episode was
+// playing at the time, but is no longer playing, it is played again.
+func restoreSnapshot(snap queueSnapshot) {
+	st := snap.state
+	playing := sound.Plr.IsPlaying()
+
+	if snap.playing && st.Head > 0 {
+		cur, _ := sound.GetHead()
+		if st.Items[st.Head-1] != cur || !playing {
+			st.Head--
+			sound.SetQueueState(st)
+			if playing {
+				sound.Plr.Stop()
+			}
+
+			return
+		}
+	}
+
+	sound.SetQueueState(st)
+}
+
+// editQueue performs an edit of the play queue which can be undone.
+func editQueue(desc string, edit func()) {
+	before := takeSnapshot()
+	edit()
+
+	recordUndo(desc, func() {
+		restoreSnapshot(before)
+	}, edit)
+}
+
+// cancelDownload cancels the ongoing download of item, if any.
+func cancelDownload(item *data.QueueItem) {
+	if y, id := data.Downloads.IsDownloading(item.Path); y {
+		data.Downloads.Cancel(id)
+	}
+}
+
+// recordCancel records the cancellation of the download of item, so that
+// the download may be restarted.
+func recordCancel(item *data.QueueItem) {
+	recordUndo("cancel download", func() {
+		item.RLock()
+		data.Downloads.Download(item)
+		item.RUnlock()
+	}, func() {
+		cancelDownload(item)
+	})
+}
+
+// RecordCleanup records the episodes removed by the last cache cleanup, so
+// that they may be restored from the trash.
+func RecordCleanup(trashed []data.Trashed) {
+	if len(trashed) == 0 {
+		return
+	}
+
+	recordUndo(fmt.Sprintf("cleanup of %d episodes", len(trashed)), func() {
+		for _, t := range trashed {
+			t.Restore()
+		}
+	}, func() {
+		for _, t := range trashed {
+			t.Trash()
+		}
+	})
+}